@@ -10,11 +10,13 @@ import (
 )
 
 type Config struct {
-	FluxComponents FluxComponentsConfig
+	FluxComponents FluxComponentsConfig `json:"fluxComponents"`
 }
 
 type FluxComponentsConfig struct {
-	SourceController, HelmController, KustomizeController bool
+	SourceController    bool `json:"sourceController"`
+	HelmController      bool `json:"helmController"`
+	KustomizeController bool `json:"kustomizeController"`
 }
 
 var WaitOptions = clients.WaitOptions{
@@ -0,0 +1,306 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientgo "k8s.io/client-go/kubernetes"
+	ctrlClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ResetFinalizerGracePeriod is how long Reset waits for objects to be deleted before
+// it removes their finalizers
+var ResetFinalizerGracePeriod = 30 * time.Second
+
+var (
+	namespaceGVK = schema.GroupVersionKind{Group: "", Version: "v1", Kind: "Namespace"}
+	crdGVK       = schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}
+)
+
+// baselineKinds are cluster-scoped kinds that Reset deletes, in that order; webhooks
+// go first, so that they don't interfere with deletion of anything else
+var baselineKinds = []schema.GroupVersionKind{
+	{Group: "admissionregistration.k8s.io", Version: "v1", Kind: "ValidatingWebhookConfiguration"},
+	{Group: "admissionregistration.k8s.io", Version: "v1", Kind: "MutatingWebhookConfiguration"},
+	namespaceGVK,
+	crdGVK,
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRoleBinding"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"},
+}
+
+// Baseline is the set of names of objects of each of the kinds that Reset deletes
+type Baseline struct {
+	Objects map[string][]string
+}
+
+type ResetReport struct {
+	// Deleted maps kinds to names of objects that were deleted
+	Deleted map[string][]string
+	// FinalizersRemoved are objects that didn't go away within ResetFinalizerGracePeriod,
+	// in '<kind>/[<namespace>/]<name>' format
+	FinalizersRemoved []string
+	// Remaining are objects that were still present when Reset gave up, in '<kind>/<name>'
+	// format, it's only set along with an error
+	Remaining []string
+}
+
+func (r *ResetReport) Empty() bool {
+	return len(r.Deleted) == 0 && len(r.FinalizersRemoved) == 0
+}
+
+// RecordBaseline records namespaces, CRDs, cluster-scoped RBAC and webhook configurations
+// that exist in the cluster, so that everything added later can be deleted by Reset
+func (m *ClientMaker) RecordBaseline(ctx context.Context) (*Baseline, error) {
+	client, err := m.NewControllerRuntimeClient()
+	if err != nil {
+		return nil, err
+	}
+	baseline := &Baseline{Objects: map[string][]string{}}
+	for _, gvk := range baselineKinds {
+		names, err := listNames(ctx, client, gvk)
+		if err != nil {
+			return nil, err
+		}
+		baseline.Objects[gvk.Kind] = names
+	}
+	return baseline, nil
+}
+
+// Reset deletes objects that are not in the baseline, waits for them to go away
+// and removes finalizers of those that remain stuck after ResetFinalizerGracePeriod
+func (m *ClientMaker) Reset(ctx context.Context, baseline *Baseline) (*ResetReport, error) {
+	client, err := m.NewControllerRuntimeClient()
+	if err != nil {
+		return nil, err
+	}
+	clientSet, err := m.NewClientSet()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ResetReport{Deleted: map[string][]string{}}
+	deleted := map[schema.GroupVersionKind][]string{}
+	for _, gvk := range baselineKinds {
+		names, err := listNames(ctx, client, gvk)
+		if err != nil {
+			return nil, err
+		}
+		known := map[string]bool{}
+		for _, name := range baseline.Objects[gvk.Kind] {
+			known[name] = true
+		}
+		for _, name := range names {
+			if known[name] {
+				continue
+			}
+			obj := &v1.PartialObjectMetadata{}
+			obj.SetGroupVersionKind(gvk)
+			obj.SetName(name)
+			m.logger.Info("Reset(): deleting object", "kind", gvk.Kind, "name", name)
+			if err := client.Delete(ctx, obj, ctrlClient.PropagationPolicy(v1.DeletePropagationBackground)); ctrlClient.IgnoreNotFound(err) != nil {
+				return nil, fmt.Errorf("failed to delete %s %q: %w", gvk.Kind, name, err)
+			}
+			deleted[gvk] = append(deleted[gvk], name)
+			report.Deleted[gvk.Kind] = append(report.Deleted[gvk.Kind], name)
+		}
+	}
+
+	remaining := func(ctx context.Context) ([]string, error) {
+		var refs []string
+		for gvk, names := range deleted {
+			for _, name := range names {
+				obj := &v1.PartialObjectMetadata{}
+				obj.SetGroupVersionKind(gvk)
+				err := client.Get(ctx, ctrlClient.ObjectKey{Name: name}, obj)
+				if err == nil {
+					refs = append(refs, gvk.Kind+"/"+name)
+					continue
+				}
+				if !apierrors.IsNotFound(err) {
+					return nil, err
+				}
+			}
+		}
+		sort.Strings(refs)
+		return refs, nil
+	}
+	gone := func(ctx context.Context) (bool, error) {
+		refs, err := remaining(ctx)
+		return len(refs) == 0, err
+	}
+
+	graceCtx, cancel := context.WithTimeout(ctx, ResetFinalizerGracePeriod)
+	defer cancel()
+	err = wait.PollUntilContextCancel(graceCtx, time.Second, true, gone)
+	if err == nil {
+		return report, nil
+	}
+	if ctx.Err() != nil || !wait.Interrupted(err) {
+		return report, err
+	}
+
+	for _, name := range deleted[namespaceGVK] {
+		removed, err := m.removeNamespaceFinalizers(ctx, client, clientSet, name)
+		report.FinalizersRemoved = append(report.FinalizersRemoved, removed...)
+		if err != nil {
+			return report, err
+		}
+	}
+	for _, name := range deleted[crdGVK] {
+		removed, err := m.removeCustomResourceFinalizers(ctx, client, name)
+		report.FinalizersRemoved = append(report.FinalizersRemoved, removed...)
+		if err != nil {
+			return report, err
+		}
+	}
+	for gvk, names := range deleted {
+		for _, name := range names {
+			obj := &unstructured.Unstructured{}
+			obj.SetGroupVersionKind(gvk)
+			obj.SetName(name)
+			removed, err := m.removeFinalizers(ctx, client, obj)
+			report.FinalizersRemoved = append(report.FinalizersRemoved, removed...)
+			if err != nil {
+				return report, err
+			}
+		}
+	}
+	sort.Strings(report.FinalizersRemoved)
+
+	graceCtx, cancel = context.WithTimeout(ctx, ResetFinalizerGracePeriod)
+	defer cancel()
+	if err := wait.PollUntilContextCancel(graceCtx, time.Second, true, gone); err != nil {
+		if refs, listErr := remaining(ctx); listErr == nil {
+			report.Remaining = refs
+		}
+		return report, fmt.Errorf("objects remain after removing finalizers: %w", err)
+	}
+	return report, nil
+}
+
+func listNames(ctx context.Context, client ctrlClient.Client, gvk schema.GroupVersionKind) ([]string, error) {
+	list := &v1.PartialObjectMetadataList{}
+	list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	if err := client.List(ctx, list); err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", gvk.Kind, err)
+	}
+	names := make([]string, 0, len(list.Items))
+	for _, item := range list.Items {
+		names = append(names, item.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// removeFinalizers patches the object unless it's gone or has no finalizers, it returns
+// the reference to the object if it was patched
+func (m *ClientMaker) removeFinalizers(ctx context.Context, client ctrlClient.Client, obj *unstructured.Unstructured) ([]string, error) {
+	if err := client.Get(ctx, ctrlClient.ObjectKeyFromObject(obj), obj); err != nil {
+		return nil, ctrlClient.IgnoreNotFound(err)
+	}
+	if len(obj.GetFinalizers()) == 0 {
+		return nil, nil
+	}
+	ref := obj.GetKind() + "/" + obj.GetName()
+	if obj.GetNamespace() != "" {
+		ref = obj.GetKind() + "/" + obj.GetNamespace() + "/" + obj.GetName()
+	}
+	m.logger.Info("Reset(): removing finalizers", "object", ref, "finalizers", obj.GetFinalizers())
+	patch := ctrlClient.RawPatch(types.MergePatchType, []byte(`{"metadata":{"finalizers":null}}`))
+	if err := client.Patch(ctx, obj, patch); ctrlClient.IgnoreNotFound(err) != nil {
+		return nil, fmt.Errorf("failed to remove finalizers of %s: %w", ref, err)
+	}
+	return []string{ref}, nil
+}
+
+// removeNamespaceFinalizers removes finalizers of all objects in the namespace that
+// can be discovered, as these block deletion of the namespace
+func (m *ClientMaker) removeNamespaceFinalizers(ctx context.Context, client ctrlClient.Client, clientSet clientgo.Interface, namespace string) ([]string, error) {
+	resources, err := clientSet.Discovery().ServerPreferredNamespacedResources()
+	if err != nil && len(resources) == 0 {
+		return nil, err
+	}
+	removedAll := []string{}
+	errs := []error{}
+	for _, resourceList := range resources {
+		gv, err := schema.ParseGroupVersion(resourceList.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, resource := range resourceList.APIResources {
+			if !canList(resource.Verbs) {
+				continue
+			}
+			list := &unstructured.UnstructuredList{}
+			list.SetGroupVersionKind(gv.WithKind(resource.Kind + "List"))
+			if err := client.List(ctx, list, ctrlClient.InNamespace(namespace)); err != nil {
+				continue
+			}
+			for i := range list.Items {
+				if len(list.Items[i].GetFinalizers()) == 0 {
+					continue
+				}
+				list.Items[i].SetGroupVersionKind(gv.WithKind(resource.Kind))
+				removed, err := m.removeFinalizers(ctx, client, &list.Items[i])
+				removedAll = append(removedAll, removed...)
+				errs = append(errs, err)
+			}
+		}
+	}
+	return removedAll, errors.Join(errs...)
+}
+
+// removeCustomResourceFinalizers removes finalizers of all custom resources defined
+// by the CRD, as these block deletion of the CRD
+func (m *ClientMaker) removeCustomResourceFinalizers(ctx context.Context, client ctrlClient.Client, crdName string) ([]string, error) {
+	crd := &unstructured.Unstructured{}
+	crd.SetGroupVersionKind(crdGVK)
+	if err := client.Get(ctx, ctrlClient.ObjectKey{Name: crdName}, crd); err != nil {
+		return nil, ctrlClient.IgnoreNotFound(err)
+	}
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	version := ""
+	for _, v := range versions {
+		if v, ok := v.(map[string]any); ok && v["storage"] == true {
+			version, _ = v["name"].(string)
+		}
+	}
+	if version == "" {
+		return nil, nil
+	}
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(schema.GroupVersionKind{Group: group, Version: version, Kind: kind + "List"})
+	if err := client.List(ctx, list); err != nil {
+		return nil, ctrlClient.IgnoreNotFound(err)
+	}
+	removedAll := []string{}
+	errs := []error{}
+	for i := range list.Items {
+		list.Items[i].SetGroupVersionKind(schema.GroupVersionKind{Group: group, Version: version, Kind: kind})
+		removed, err := m.removeFinalizers(ctx, client, &list.Items[i])
+		removedAll = append(removedAll, removed...)
+		errs = append(errs, err)
+	}
+	return removedAll, errors.Join(errs...)
+}
+
+func canList(verbs []string) bool {
+	for _, verb := range verbs {
+		if verb == "list" {
+			return true
+		}
+	}
+	return false
+}
@@ -24,7 +24,25 @@ import (
 
 type ClientMakerBase struct {
 	*rest.Config
-	logger klog.Logger
+	logger  klog.Logger
+	factory ClientFactory
+}
+
+// ClientFactory constructs the underlying clients, it's what allows ClientMaker
+// to be backed by something other than a real API server
+type ClientFactory interface {
+	NewControllerRuntimeClient(*rest.Config, ctrlClient.Options) (ctrlClient.Client, error)
+	NewClientSet(*rest.Config) (clientgo.Interface, error)
+}
+
+type restClientFactory struct{}
+
+func (restClientFactory) NewControllerRuntimeClient(config *rest.Config, options ctrlClient.Options) (ctrlClient.Client, error) {
+	return ctrlClient.New(config, options)
+}
+
+func (restClientFactory) NewClientSet(config *rest.Config) (clientgo.Interface, error) {
+	return clientgo.NewForConfig(config)
 }
 
 type ClientMaker struct {
@@ -56,10 +74,15 @@ type (
 )
 
 func NewClientMaker(config *rest.Config, logger klog.Logger) *ClientMaker {
+	return NewClientMakerWithFactory(config, logger, restClientFactory{})
+}
+
+func NewClientMakerWithFactory(config *rest.Config, logger klog.Logger, factory ClientFactory) *ClientMaker {
 	return &ClientMaker{
 		ClientMakerBase: &ClientMakerBase{
-			Config: rest.CopyConfig(config),
-			logger: logger,
+			Config:  rest.CopyConfig(config),
+			logger:  logger,
+			factory: factory,
 		},
 		ResourceMetadataTemplate: v1.ObjectMeta{
 			GenerateName: "kte-",
@@ -78,7 +101,7 @@ func (m *ClientMakerBase) NewControllerRuntimeClient() (ctrlClient.Client, error
 		return nil, err
 	}
 
-	return ctrlClient.New(clientConfig, options)
+	return m.factory.NewControllerRuntimeClient(clientConfig, options)
 }
 
 func (m *ClientMakerBase) NewClientSet() (clientgo.Interface, error) {
@@ -90,7 +113,7 @@ func (m *ClientMakerBase) NewClientSet() (clientgo.Interface, error) {
 			Deduplicate: true,
 		},
 	)
-	return clientgo.NewForConfig(clientConfig)
+	return m.factory.NewClientSet(clientConfig)
 }
 
 func (m *ClientMakerBase) NewResourceManager() (*ResourceManager, error) {
@@ -113,6 +136,17 @@ func (m *ClientMakerBase) NewResourceManager() (*ResourceManager, error) {
 }
 
 func (m *ClientMaker) NewNamespacedClientMaker(ctx context.Context, meta *v1.ObjectMeta) (*NamespacedClientMaker, error) {
+	clientMaker, err := m.newNamespacedClientMaker(ctx, meta)
+	if err != nil {
+		return nil, err
+	}
+	m.cleanupCallbacks = append(m.cleanupCallbacks, clientMaker.Cleanup)
+	return clientMaker, nil
+}
+
+// newNamespacedClientMaker is like NewNamespacedClientMaker, but it's up to the caller to
+// call Cleanup of the returned client maker
+func (m *ClientMaker) newNamespacedClientMaker(ctx context.Context, meta *v1.ObjectMeta) (*NamespacedClientMaker, error) {
 	clientSet, err := m.NewClientSet()
 	if err != nil {
 		return nil, err
@@ -171,8 +205,9 @@ func (m *ClientMaker) NewNamespacedClientMaker(ctx context.Context, meta *v1.Obj
 
 	clientMaker := &NamespacedClientMaker{
 		ClientMakerBase: &ClientMakerBase{
-			Config: clientConfig,
-			logger: m.logger,
+			Config:  clientConfig,
+			logger:  m.logger,
+			factory: m.factory,
 		},
 		Namespace: meta.Namespace,
 		DefaultControllerRuntimeListOptions: &ctrlClient.ListOptions{
@@ -196,7 +231,6 @@ func (m *ClientMaker) NewNamespacedClientMaker(ctx context.Context, meta *v1.Obj
 			m.logger.Error(err, "failed to delete namespace")
 		}
 	}
-	m.cleanupCallbacks = append(m.cleanupCallbacks, clientMaker.Cleanup)
 
 	return clientMaker, nil
 }
@@ -0,0 +1,132 @@
+package clients
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/testr"
+	"k8s.io/klog/v2"
+)
+
+// NameForTest turns a test name into something that can be used as a prefix of
+// a resource name, e.g. 'TestFoo/bar_baz' becomes 'testfoo-bar-baz'
+func NameForTest(t testing.TB, maxLength int) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		default:
+			return '-'
+		}
+	}, t.Name())
+	for strings.Contains(name, "--") {
+		name = strings.ReplaceAll(name, "--", "-")
+	}
+	if len(name) > maxLength {
+		name = name[:maxLength]
+	}
+	return strings.Trim(name, "-")
+}
+
+// NamespaceForTest creates a namespace named after the test with a service account
+// bound to it, which gets deleted when the test completes; the test fails if any
+// of the resources cannot be created; logs go to t.Log while the test is running,
+// and to the logger of m afterwards
+func (m *ClientMaker) NamespaceForTest(t testing.TB) *NamespacedClientMaker {
+	t.Helper()
+
+	ctx := context.Background()
+
+	meta := m.ResourceMetadataTemplate.DeepCopy()
+	// leave enough space for the random suffix and service account name
+	meta.GenerateName += NameForTest(t, 40) + "-"
+
+	// the namespace is deleted by t.Cleanup only, and not by Cleanup of m
+	clientMaker, err := m.newNamespacedClientMaker(ctx, meta)
+	if err != nil {
+		t.Fatalf("failed to create namespace for test: %v", err)
+	}
+	sink := &testLogSink{
+		state:    &testLogState{},
+		test:     testr.NewWithInterface(t, testr.Options{}),
+		fallback: m.logger,
+	}
+	clientMaker.logger = logr.New(sink)
+
+	t.Logf("Created namespace %q", clientMaker.Namespace)
+	t.Cleanup(func() {
+		clientMaker.Cleanup(ctx)
+		sink.state.finish()
+	})
+	return clientMaker
+}
+
+type testLogState struct {
+	lock sync.RWMutex
+	done bool
+}
+
+func (s *testLogState) finish() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.done = true
+}
+
+// testLogSink writes to the test logger until the test has completed, and to the
+// fallback logger afterwards, as logging via t.Log at that point panics; background
+// goroutines, e.g. watches, may well outlive the test
+type testLogSink struct {
+	state    *testLogState
+	test     klog.Logger
+	fallback klog.Logger
+}
+
+var _ logr.LogSink = &testLogSink{}
+
+func (s *testLogSink) logger() klog.Logger {
+	if s.state.done {
+		return s.fallback
+	}
+	return s.test
+}
+
+func (s *testLogSink) Init(logr.RuntimeInfo) {}
+
+func (s *testLogSink) Enabled(level int) bool {
+	s.state.lock.RLock()
+	defer s.state.lock.RUnlock()
+	return s.logger().V(level).Enabled()
+}
+
+func (s *testLogSink) Info(level int, msg string, keysAndValues ...any) {
+	s.state.lock.RLock()
+	defer s.state.lock.RUnlock()
+	s.logger().V(level).Info(msg, keysAndValues...)
+}
+
+func (s *testLogSink) Error(err error, msg string, keysAndValues ...any) {
+	s.state.lock.RLock()
+	defer s.state.lock.RUnlock()
+	s.logger().Error(err, msg, keysAndValues...)
+}
+
+func (s *testLogSink) WithValues(keysAndValues ...any) logr.LogSink {
+	return &testLogSink{
+		state:    s.state,
+		test:     s.test.WithValues(keysAndValues...),
+		fallback: s.fallback.WithValues(keysAndValues...),
+	}
+}
+
+func (s *testLogSink) WithName(name string) logr.LogSink {
+	return &testLogSink{
+		state:    s.state,
+		test:     s.test.WithName(name),
+		fallback: s.fallback.WithName(name),
+	}
+}
@@ -0,0 +1,49 @@
+// kte-gc deletes kind clusters that were left behind by test processes that got killed
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	klog "k8s.io/klog/v2"
+
+	"github.com/errordeveloper/kube-test-env/provider/kind"
+)
+
+func main() {
+	opts := kind.GCOptions{}
+
+	flag.DurationVar(&opts.TTL, "ttl", 0, "delete clusters older than this regardless of whether their owner is still running (disabled if 0)")
+	flag.BoolVar(&opts.DeleteUntracked, "delete-untracked", false, "delete clusters without recorded metadata")
+	flag.BoolVar(&opts.DeleteRetained, "delete-retained", false, "delete clusters that were retained for inspection")
+	flag.BoolVar(&opts.DryRun, "dry-run", false, "only list clusters that would be deleted")
+	cluster := flag.String("cluster", "", "delete only the cluster with this name, regardless of whether it's orphaned")
+	flag.StringVar(&kind.StateDir, "state-dir", kind.StateDir, "directory where cluster metadata is recorded (also set via "+kind.EnvStateDir+")")
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	opts.Logger = klog.NewKlogr().WithName("kte-gc")
+
+	if *cluster != "" {
+		if err := kind.DeleteCluster(opts.Logger, *cluster); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	orphaned, err := kind.GC(opts)
+	for _, o := range orphaned {
+		age := "unknown"
+		if o.Metadata != nil {
+			age = time.Since(o.Metadata.Created).Round(time.Second).String()
+		}
+		fmt.Printf("%s\tage=%s\treason=%q\n", o.Name, age, o.Reason)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
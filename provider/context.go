@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CancelledError is returned by the context-aware lifecycle methods when
+// the context is done before the operation completes
+type CancelledError struct {
+	Op          string
+	ClusterName string
+	Err         error
+	// Running is set when the operation didn't return within CancelGracePeriod,
+	// state that it uses must not be accessed
+	Running bool
+}
+
+func (e *CancelledError) Error() string {
+	return fmt.Sprintf("%s(): cancelled for cluster '%s': %v", e.Op, e.ClusterName, e.Err)
+}
+
+func (e *CancelledError) Unwrap() error { return e.Err }
+
+func IsCancelled(err error) bool {
+	var cancelled *CancelledError
+	return errors.As(err, &cancelled)
+}
+
+// IsStillRunning returns true when err is a CancelledError of an operation that
+// was still running when RunContext gave up waiting for it
+func IsStillRunning(err error) bool {
+	var cancelled *CancelledError
+	return errors.As(err, &cancelled) && cancelled.Running
+}
+
+// CancelGracePeriod is how long RunContext waits for an operation to return
+// after it was aborted
+var CancelGracePeriod = 30 * time.Second
+
+// RunContext runs fn in the background and returns its error; fn is given ctx, and
+// when ctx is done before fn returns, abort is called to unblock parts of fn that
+// cannot be interrupted (e.g. by deleting a cluster that is being created), then
+// RunContext waits up to CancelGracePeriod for fn to return and returns CancelledError;
+// any cleanup that depends on the state fn leaves behind belongs in fn itself
+func RunContext(ctx context.Context, op, clusterName string, fn func(context.Context) error, abort func()) error {
+	cancelled := func(err error) *CancelledError {
+		return &CancelledError{Op: op, ClusterName: clusterName, Err: errors.Join(ctx.Err(), err)}
+	}
+	if ctx.Err() != nil {
+		return cancelled(nil)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+
+	select {
+	case err := <-done:
+		// a failure that coincides with cancellation is most likely caused by it
+		if err != nil && ctx.Err() != nil {
+			return cancelled(err)
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	if abort != nil {
+		abort()
+	}
+	select {
+	case err := <-done:
+		return cancelled(err)
+	case <-time.After(CancelGracePeriod):
+		err := cancelled(nil)
+		err.Running = true
+		return err
+	}
+}
+
+// TimeoutFromContext returns time left until the deadline of ctx, or fallback
+// when ctx has no deadline
+func TimeoutFromContext(ctx context.Context, fallback time.Duration) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline)
+	}
+	return fallback
+}
@@ -0,0 +1,66 @@
+package provider_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/errordeveloper/kube-test-env/provider"
+)
+
+func TestRunContext(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(provider.RunContext(context.Background(), "Create", "kte-test",
+		func(context.Context) error { return nil }, nil)).To(Succeed())
+
+	failure := errors.New("failure")
+	g.Expect(provider.RunContext(context.Background(), "Create", "kte-test",
+		func(context.Context) error { return failure }, nil)).To(MatchError(failure))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	unblock := make(chan struct{})
+	aborted := false
+	err := provider.RunContext(ctx, "Create", "kte-test",
+		func(context.Context) error { <-unblock; return failure },
+		func() { aborted = true; close(unblock) })
+	g.Expect(provider.IsCancelled(err)).To(BeTrue())
+	g.Expect(provider.IsStillRunning(err)).To(BeFalse())
+	g.Expect(err).To(MatchError(context.DeadlineExceeded))
+	g.Expect(err).To(MatchError(failure))
+	g.Expect(err.Error()).To(ContainSubstring("Create(): cancelled for cluster 'kte-test'"))
+	g.Expect(aborted).To(BeTrue())
+
+	called := false
+	err = provider.RunContext(ctx, "Delete", "kte-test", func(context.Context) error { called = true; return nil }, nil)
+	g.Expect(provider.IsCancelled(err)).To(BeTrue())
+	g.Expect(called).To(BeFalse())
+
+	// fn is waited for until it returns, it's expected to observe ctx on its own
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	returned := false
+	err = provider.RunContext(ctx, "Delete", "kte-test", func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		returned = true
+		return nil
+	}, nil)
+	g.Expect(provider.IsCancelled(err)).To(BeTrue())
+	g.Expect(returned).To(BeTrue())
+
+	defer func(gracePeriod time.Duration) { provider.CancelGracePeriod = gracePeriod }(provider.CancelGracePeriod)
+	provider.CancelGracePeriod = 10 * time.Millisecond
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	unblock = make(chan struct{})
+	defer close(unblock)
+	err = provider.RunContext(ctx, "Delete", "kte-test", func(context.Context) error { <-unblock; return nil }, nil)
+	g.Expect(provider.IsStillRunning(err)).To(BeTrue())
+}
@@ -0,0 +1,212 @@
+package envtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+
+	klog "k8s.io/klog/v2"
+	ctrlenvtest "sigs.k8s.io/controller-runtime/pkg/envtest"
+
+	"github.com/errordeveloper/kube-test-env/provider"
+)
+
+const (
+	Name              = "envtest"
+	ClusterNamePrefix = "kte-envtest-"
+
+	// EnvBinaryAssets points to a directory with etcd and kube-apiserver binaries,
+	// KUBEBUILDER_ASSETS and TEST_ASSET_{ETCD,KUBE_APISERVER} are also respected
+	EnvBinaryAssets = "KTE_ENVTEST_ASSETS"
+)
+
+type Managed struct {
+	provider.Common[provider.Provider]
+
+	UUID uuid.UUID
+
+	*ctrlenvtest.Environment
+
+	BinaryAssetsDirectory string
+	Timeout               time.Duration
+
+	ArtifactDir string
+	Logger      klog.Logger
+
+	logFiles []*os.File
+}
+
+var _ provider.Lifecycle = &Managed{}
+
+func init() {
+	provider.Register(Name, func(opts provider.Options) (provider.Lifecycle, error) {
+		if opts.Config != nil {
+			opts.Logger.Info("ignoring cluster config", "provider", Name, "config-type", fmt.Sprintf("%T", opts.Config))
+		}
+		k := New(opts.ArtifactDir, opts.Logger)
+		k.Timeout = opts.Timeout
+		return k, nil
+	})
+}
+
+func New(artifactDir string, logger klog.Logger) *Managed {
+	uuid := uuid.New()
+	k := &Managed{
+		UUID:                  uuid,
+		Environment:           &ctrlenvtest.Environment{},
+		BinaryAssetsDirectory: os.Getenv(EnvBinaryAssets),
+		ArtifactDir:           artifactDir,
+		Logger:                logger.WithName("envtest-provider").WithValues("envtest-provider-uuid", uuid.String()),
+	}
+	k.Common = provider.NewCommon[provider.Provider](k, logger)
+	return k
+}
+
+func (k *Managed) ClusterName() string {
+	return ClusterNamePrefix + k.UUID.String()
+}
+
+func (k *Managed) KubeConfigPath() string {
+	return filepath.Join(k.ArtifactDir, k.ClusterName(), "kubeconfig")
+}
+
+func (k *Managed) LogsDir() string {
+	return filepath.Join(k.ArtifactDir, k.ClusterName(), "logs")
+}
+
+func (k *Managed) Create() error { return k.create(k.Timeout) }
+
+// CreateContext limits start up time of each process to the deadline of ctx, and
+// stops the processes if ctx is done before the API server is ready
+func (k *Managed) CreateContext(ctx context.Context) error {
+	timeout := provider.TimeoutFromContext(ctx, k.Timeout)
+	return provider.RunContext(ctx, "Create", k.ClusterName(), func(ctx context.Context) error {
+		err := k.create(timeout)
+		// processes can only be stopped once Start returns
+		if ctx.Err() != nil {
+			if err := k.Environment.Stop(); err != nil {
+				k.Logger.Error(err, "failed to stop half-started control plane")
+			}
+		}
+		return err
+	}, nil)
+}
+
+func (k *Managed) create(timeout time.Duration) error {
+	k.Logger.Info("Create(): starting etcd and kube-apiserver", "cluster-name", k.ClusterName())
+
+	if err := os.MkdirAll(k.LogsDir(), 0o755); err != nil {
+		return err
+	}
+
+	etcdLog, err := k.openLog("etcd.log")
+	if err != nil {
+		return err
+	}
+	apiServerLog, err := k.openLog("kube-apiserver.log")
+	if err != nil {
+		return err
+	}
+
+	if k.Environment.ControlPlane.Etcd == nil {
+		k.Environment.ControlPlane.Etcd = &ctrlenvtest.Etcd{}
+	}
+	k.Environment.ControlPlane.Etcd.Out = etcdLog
+	k.Environment.ControlPlane.Etcd.Err = etcdLog
+
+	apiServer := k.Environment.ControlPlane.GetAPIServer()
+	apiServer.Out = apiServerLog
+	apiServer.Err = apiServerLog
+
+	if k.BinaryAssetsDirectory != "" {
+		k.Environment.BinaryAssetsDirectory = k.BinaryAssetsDirectory
+	}
+	if timeout != 0 {
+		k.Environment.ControlPlaneStartTimeout = timeout
+	}
+
+	if _, err := k.Environment.Start(); err != nil {
+		k.closeLogs()
+		return fmt.Errorf("unable to start envtest control plane (see logs in %q): %w", k.LogsDir(), err)
+	}
+
+	if err := k.writeKubeConfig(); err != nil {
+		return errors.Join(err, k.stop())
+	}
+	return nil
+}
+
+func (k *Managed) writeKubeConfig() error {
+	user, err := k.Environment.AddUser(ctrlenvtest.User{
+		Name:   "kte-admin",
+		Groups: []string{"system:masters"},
+	}, nil)
+	if err != nil {
+		return err
+	}
+	kubeconfig, err := user.KubeConfig()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(k.KubeConfigPath(), kubeconfig, 0o600)
+}
+
+func (k *Managed) openLog(name string) (*os.File, error) {
+	f, err := os.Create(filepath.Join(k.LogsDir(), name))
+	if err != nil {
+		return nil, err
+	}
+	k.logFiles = append(k.logFiles, f)
+	return f, nil
+}
+
+// CollectLogs flushes etcd and kube-apiserver logs, which are written to LogsDir
+// while the processes are running
+func (k *Managed) CollectLogs() error {
+	k.Logger.Info("CollectLogs(): syncing logs", "cluster-name", k.ClusterName())
+	for _, f := range k.logFiles {
+		if err := f.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (k *Managed) Delete() error {
+	k.Logger.Info("Delete(): stopping etcd and kube-apiserver", "cluster-name", k.ClusterName())
+	if err := k.stop(); err != nil {
+		return err
+	}
+	if err := os.Remove(k.KubeConfigPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (k *Managed) stop() error {
+	if err := k.Environment.Stop(); err != nil {
+		return err
+	}
+	k.closeLogs()
+	return nil
+}
+
+func (k *Managed) closeLogs() {
+	for _, f := range k.logFiles {
+		_ = f.Close()
+	}
+	k.logFiles = nil
+}
+
+func (k *Managed) CollectLogsContext(ctx context.Context) error {
+	return provider.RunContext(ctx, "CollectLogs", k.ClusterName(), func(context.Context) error { return k.CollectLogs() }, nil)
+}
+
+func (k *Managed) DeleteContext(ctx context.Context) error {
+	return provider.RunContext(ctx, "Delete", k.ClusterName(), func(context.Context) error { return k.Delete() }, nil)
+}
@@ -0,0 +1,72 @@
+package envtest_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	klog "k8s.io/klog/v2"
+
+	"github.com/errordeveloper/kube-test-env/provider/envtest"
+)
+
+func TestEnvtestCreateAccessDelete(t *testing.T) {
+	if os.Getenv(envtest.EnvBinaryAssets) == "" && os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("neither " + envtest.EnvBinaryAssets + " nor KUBEBUILDER_ASSETS is set")
+	}
+
+	g := NewWithT(t)
+
+	ctx := context.Background()
+
+	log := klog.FromContext(ctx)
+
+	k := envtest.New(t.TempDir(), log)
+
+	g.Expect(k.Create()).To(Succeed())
+
+	t.Logf("Created cluster name=%q kubeconfig=%q", k.ClusterName(), k.KubeConfigPath())
+
+	g.Expect(k.KubeConfigPath()).To(BeAnExistingFile())
+
+	clientConfig, err := k.NewClientConfig()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(clientConfig.Host).To(HavePrefix("https://127.0.0.1:"))
+
+	clients, err := k.NewClientMaker()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	{
+		clientSet, err := clients.NewClientSet()
+		g.Expect(err).NotTo(HaveOccurred())
+
+		namespaces, err := clientSet.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(namespaces.Items).NotTo(BeEmpty())
+	}
+
+	{
+		clients, err := clients.NewNamespacedClientMaker(ctx, nil)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		client, err := clients.NewControllerRuntimeClient()
+		g.Expect(err).NotTo(HaveOccurred())
+
+		serviceAccounts := &corev1.ServiceAccountList{}
+		g.Expect(client.List(ctx, serviceAccounts, clients.DefaultControllerRuntimeListOptions)).To(Succeed())
+		// there is no controller-manager to create the default service account
+		g.Expect(serviceAccounts.Items).To(HaveLen(1))
+	}
+
+	clients.Cleanup(ctx)
+
+	g.Expect(k.CollectLogs()).To(Succeed())
+	g.Expect(k.LogsDir()).To(BeADirectory())
+
+	g.Expect(k.Delete()).To(Succeed())
+	g.Expect(k.KubeConfigPath()).NotTo(BeAnExistingFile())
+}
@@ -0,0 +1,103 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"k8s.io/client-go/rest"
+	klog "k8s.io/klog/v2"
+
+	"github.com/errordeveloper/kube-test-env/clients"
+	"github.com/errordeveloper/kube-test-env/provider"
+)
+
+const (
+	Name              = "fake"
+	ClusterNamePrefix = "kte-fake-"
+)
+
+// Managed is an in-process provider without any API server, all clients
+// handed out by NewClientMaker are backed by the same in-memory Store;
+// impersonation is ignored, so namespaced clients are not restricted
+type Managed struct {
+	provider.Common[provider.Provider]
+
+	UUID uuid.UUID
+
+	*Store
+
+	Logger klog.Logger
+}
+
+var _ provider.Lifecycle = &Managed{}
+
+func init() {
+	provider.Register(Name, func(opts provider.Options) (provider.Lifecycle, error) {
+		if opts.Config != nil {
+			opts.Logger.Info("ignoring cluster config", "provider", Name, "config-type", fmt.Sprintf("%T", opts.Config))
+		}
+		return New(opts.Logger), nil
+	})
+}
+
+func New(logger klog.Logger) *Managed {
+	uuid := uuid.New()
+	k := &Managed{
+		UUID:   uuid,
+		Store:  NewStore(),
+		Logger: logger.WithName("fake-provider").WithValues("fake-provider-uuid", uuid.String()),
+	}
+	k.Common = provider.NewCommon[provider.Provider](k, logger)
+	return k
+}
+
+func (k *Managed) ClusterName() string {
+	return ClusterNamePrefix + k.UUID.String()
+}
+
+func (k *Managed) KubeConfigPath() string { return "" }
+func (k *Managed) LogsDir() string        { return "" }
+
+func (k *Managed) NewClientConfig() (*rest.Config, error) {
+	return &rest.Config{Host: "fake://" + k.ClusterName()}, nil
+}
+
+func (k *Managed) NewClientMaker() (*clients.ClientMaker, error) {
+	clientConfig, err := k.NewClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	return clients.NewClientMakerWithFactory(clientConfig, provider.Log, k.Store), nil
+}
+
+func (k *Managed) Create() error {
+	k.Logger.Info("Create(): using in-memory store", "cluster-name", k.ClusterName())
+	return nil
+}
+
+func (k *Managed) CollectLogs() error {
+	k.Logger.Info("CollectLogs(): no-op, there are no logs", "cluster-name", k.ClusterName())
+	return nil
+}
+
+// Delete drops all objects by replacing the store, clients that were handed out
+// before keep pointing to the old one
+func (k *Managed) Delete() error {
+	k.Logger.Info("Delete(): resetting in-memory store", "cluster-name", k.ClusterName())
+	k.Store = NewStore()
+	return nil
+}
+
+func (k *Managed) CreateContext(ctx context.Context) error {
+	return provider.RunContext(ctx, "Create", k.ClusterName(), func(context.Context) error { return k.Create() }, nil)
+}
+
+func (k *Managed) CollectLogsContext(ctx context.Context) error {
+	return provider.RunContext(ctx, "CollectLogs", k.ClusterName(), func(context.Context) error { return k.CollectLogs() }, nil)
+}
+
+func (k *Managed) DeleteContext(ctx context.Context) error {
+	return provider.RunContext(ctx, "Delete", k.ClusterName(), func(context.Context) error { return k.Delete() }, nil)
+}
@@ -0,0 +1,214 @@
+package fake_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	klog "k8s.io/klog/v2"
+	ctrlClient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/errordeveloper/kube-test-env/clients"
+	"github.com/errordeveloper/kube-test-env/provider/fake"
+)
+
+const configMapManifest = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+  namespace: %s
+data:
+  foo: bar
+`
+
+const crdManifest = `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: foos.example.com
+spec:
+  group: example.com
+  names:
+    kind: Foo
+    plural: foos
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+`
+
+func TestFakeCreateAccessDelete(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.Background()
+
+	log := klog.FromContext(ctx)
+
+	k := fake.New(log)
+
+	g.Expect(k.Create()).To(Succeed())
+
+	maker, err := k.NewClientMaker()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	clientSet, err := maker.NewClientSet()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	client, err := maker.NewControllerRuntimeClient()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	namespaces, err := clientSet.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(namespaces.Items).To(HaveLen(4))
+
+	namespaced, err := maker.NewNamespacedClientMaker(ctx, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(namespaced.Namespace).To(HavePrefix("kte-"))
+
+	{
+		namespace := &corev1.Namespace{}
+		g.Expect(client.Get(ctx, ctrlClient.ObjectKey{Name: namespaced.Namespace}, namespace)).To(Succeed())
+
+		serviceAccounts := &corev1.ServiceAccountList{}
+		g.Expect(client.List(ctx, serviceAccounts, namespaced.DefaultControllerRuntimeListOptions)).To(Succeed())
+		g.Expect(serviceAccounts.Items).To(HaveLen(1))
+		g.Expect(serviceAccounts.Items[0].Name).To(HavePrefix(namespaced.Namespace + "-"))
+
+		roleBindings, err := clientSet.RbacV1().RoleBindings(namespaced.Namespace).List(ctx, metav1.ListOptions{})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(roleBindings.Items).To(HaveLen(1))
+	}
+
+	{
+		rm, err := namespaced.NewResourceManager()
+		g.Expect(err).NotTo(HaveOccurred())
+
+		manifest := func() *bytes.Buffer {
+			return bytes.NewBufferString(fmt.Sprintf(configMapManifest, namespaced.Namespace))
+		}
+
+		changeSet, err := rm.ApplyManifest(ctx, nil, manifest())
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(changeSet.Entries).To(HaveLen(1))
+		g.Expect(string(changeSet.Entries[0].Action)).To(Equal("created"))
+
+		configMap, err := clientSet.CoreV1().ConfigMaps(namespaced.Namespace).Get(ctx, "test", metav1.GetOptions{})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(configMap.Data).To(HaveKeyWithValue("foo", "bar"))
+
+		changeSet, err = rm.ApplyManifest(ctx, &clients.WaitOptions{Interval: 10 * time.Millisecond, Timeout: time.Second}, manifest())
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(string(changeSet.Entries[0].Action)).To(Equal("unchanged"))
+	}
+
+	{
+		rm, err := maker.NewResourceManager()
+		g.Expect(err).NotTo(HaveOccurred())
+
+		changeSet, err := rm.ApplyManifest(ctx, nil, bytes.NewBufferString(crdManifest))
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(changeSet.Entries).To(HaveLen(1))
+	}
+
+	maker.Cleanup(ctx)
+
+	_, err = clientSet.CoreV1().Namespaces().Get(ctx, namespaced.Namespace, metav1.GetOptions{})
+	g.Expect(err).To(HaveOccurred())
+
+	g.Expect(k.Delete()).To(Succeed())
+}
+
+func TestFakeNamespaceForTest(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.Background()
+
+	k := fake.New(klog.FromContext(ctx))
+	g.Expect(k.Create()).To(Succeed())
+
+	maker, err := k.NewClientMaker()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	var namespace string
+	t.Run("Sub/Test_Name", func(t *testing.T) {
+		g := NewWithT(t)
+
+		namespaced := maker.NamespaceForTest(t)
+		namespace = namespaced.Namespace
+		g.Expect(namespace).To(HavePrefix("kte-testfakenamespacefortest-sub-test-name-"))
+
+		_, err := k.ClientSet.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+		g.Expect(err).NotTo(HaveOccurred())
+	})
+
+	_, err = k.ClientSet.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	g.Expect(err).To(HaveOccurred())
+
+	g.Expect(k.Delete()).To(Succeed())
+}
+
+func TestFakeReset(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.Background()
+
+	k := fake.New(klog.FromContext(ctx))
+	g.Expect(k.Create()).To(Succeed())
+
+	maker, err := k.NewClientMaker()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	client, err := maker.NewControllerRuntimeClient()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	baseline, err := maker.RecordBaseline(ctx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(baseline.Objects["Namespace"]).To(HaveLen(4))
+
+	report, err := maker.Reset(ctx, baseline)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(report.Empty()).To(BeTrue())
+
+	rm, err := maker.NewResourceManager()
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = rm.ApplyManifest(ctx, nil, bytes.NewBufferString(crdManifest))
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(client.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test"}})).To(Succeed())
+	g.Expect(client.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:       "test-stuck",
+		Finalizers: []string{"example.com/stuck"},
+	}})).To(Succeed())
+	g.Expect(client.Create(ctx, &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "test"}})).To(Succeed())
+
+	gracePeriod := clients.ResetFinalizerGracePeriod
+	clients.ResetFinalizerGracePeriod = 100 * time.Millisecond
+	defer func() { clients.ResetFinalizerGracePeriod = gracePeriod }()
+
+	report, err = maker.Reset(ctx, baseline)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(report.Deleted).To(Equal(map[string][]string{
+		"Namespace":                {"test", "test-stuck"},
+		"CustomResourceDefinition": {"foos.example.com"},
+		"ClusterRole":              {"test"},
+	}))
+	g.Expect(report.FinalizersRemoved).To(ConsistOf("Namespace/test-stuck"))
+
+	namespaces := &corev1.NamespaceList{}
+	g.Expect(client.List(ctx, namespaces)).To(Succeed())
+	g.Expect(namespaces.Items).To(HaveLen(4))
+
+	err = client.Get(ctx, ctrlClient.ObjectKey{Name: "test"}, &rbacv1.ClusterRole{})
+	g.Expect(err).To(HaveOccurred())
+
+	g.Expect(k.Delete()).To(Succeed())
+}
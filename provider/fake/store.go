@@ -0,0 +1,194 @@
+package fake
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/meta/testrestmapper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	clientgo "k8s.io/client-go/kubernetes"
+	fakeclientgo "k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	clientgotesting "k8s.io/client-go/testing"
+	ctrlClient "sigs.k8s.io/controller-runtime/pkg/client"
+	fakectrl "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// Store is an in-memory API, the controller-runtime client and the clientset
+// it hands out share one object tracker, so objects created by either are
+// visible to both
+type Store struct {
+	Scheme     *runtime.Scheme
+	RESTMapper meta.RESTMapper
+	Tracker    clientgotesting.ObjectTracker
+
+	Client    ctrlClient.WithWatch
+	ClientSet *fakeclientgo.Clientset
+}
+
+var crdGVK = schema.GroupVersionKind{
+	Group:   "apiextensions.k8s.io",
+	Version: "v1",
+	Kind:    "CustomResourceDefinition",
+}
+
+var initialNamespaces = []string{
+	metav1.NamespaceDefault,
+	metav1.NamespaceSystem,
+	metav1.NamespacePublic,
+	corev1.NamespaceNodeLease,
+}
+
+func NewStore() *Store {
+	s := &Store{
+		Scheme:    runtime.NewScheme(),
+		ClientSet: fakeclientgo.NewSimpleClientset(),
+	}
+	utilruntime.Must(clientgoscheme.AddToScheme(s.Scheme))
+	utilruntime.Must(apiextensionsv1.AddToScheme(s.Scheme))
+	s.RESTMapper = testrestmapper.TestOnlyStaticRESTMapper(s.Scheme)
+	s.Tracker = clientgotesting.NewObjectTracker(s.Scheme, serializer.NewCodecFactory(s.Scheme).UniversalDecoder())
+
+	// the clientset has its own tracker with a scheme that only knows built-in types,
+	// so its reactors need to be pointed to the one that is also used by the client
+	s.ClientSet.PrependReactor("*", "*", clientgotesting.ObjectReaction(s.Tracker))
+	s.ClientSet.PrependWatchReactor("*", func(action clientgotesting.Action) (bool, watch.Interface, error) {
+		w, err := s.Tracker.Watch(action.GetResource(), action.GetNamespace())
+		if err != nil {
+			return false, nil, err
+		}
+		return true, w, nil
+	})
+	s.ClientSet.PrependReactor("create", "*", generateName)
+
+	s.Client = fakectrl.NewClientBuilder().
+		WithScheme(s.Scheme).
+		WithRESTMapper(s.RESTMapper).
+		WithObjectTracker(s.Tracker).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Patch: serverSideApply,
+			List:  ignoreEmptyFieldSelector,
+		}).
+		Build()
+
+	for _, name := range initialNamespaces {
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceActive},
+		}
+		// it's a fresh tracker, so the only possible error is a programming error
+		if err := s.Client.Create(context.Background(), namespace); err != nil {
+			panic(err)
+		}
+	}
+	return s
+}
+
+func (s *Store) NewControllerRuntimeClient(_ *rest.Config, _ ctrlClient.Options) (ctrlClient.Client, error) {
+	return s.Client, nil
+}
+
+func (s *Store) NewClientSet(_ *rest.Config) (clientgo.Interface, error) {
+	return s.ClientSet, nil
+}
+
+// generateName fills in the name for objects created via the clientset, which
+// the object tracker doesn't do on its own, it always returns false so that
+// the default reactor handles the object
+func generateName(action clientgotesting.Action) (bool, runtime.Object, error) {
+	create, ok := action.(clientgotesting.CreateAction)
+	if !ok {
+		return false, nil, nil
+	}
+	obj, err := meta.Accessor(create.GetObject())
+	if err != nil {
+		return false, nil, nil
+	}
+	if obj.GetName() == "" && obj.GetGenerateName() != "" {
+		obj.SetName(obj.GetGenerateName() + utilrand.String(5))
+	}
+	if obj.GetResourceVersion() == "" {
+		obj.SetResourceVersion("1")
+	}
+	return false, nil, nil
+}
+
+// serverSideApply approximates server-side apply, which the fake client doesn't
+// support, by creating the object or replacing the existing one; field ownership
+// is not tracked and dry-run merely returns the object as it would be stored
+func serverSideApply(ctx context.Context, c ctrlClient.WithWatch, obj ctrlClient.Object, patch ctrlClient.Patch, opts ...ctrlClient.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return c.Patch(ctx, obj, patch, opts...)
+	}
+
+	patchOptions := &ctrlClient.PatchOptions{}
+	patchOptions.ApplyOptions(opts)
+	dryRun := len(patchOptions.DryRun) > 0
+
+	markEstablished(obj)
+
+	existing, ok := obj.DeepCopyObject().(ctrlClient.Object)
+	if !ok {
+		return c.Patch(ctx, obj, patch, opts...)
+	}
+	err := c.Get(ctx, ctrlClient.ObjectKeyFromObject(obj), existing)
+	switch {
+	case apierrors.IsNotFound(err):
+		if dryRun {
+			return nil
+		}
+		obj.SetResourceVersion("")
+		return c.Create(ctx, obj)
+	case err != nil:
+		return err
+	}
+
+	obj.SetResourceVersion(existing.GetResourceVersion())
+	obj.SetUID(existing.GetUID())
+	obj.SetCreationTimestamp(existing.GetCreationTimestamp())
+	if dryRun {
+		return nil
+	}
+	return c.Update(ctx, obj)
+}
+
+// ignoreEmptyFieldSelector drops empty field selectors, which the fake client
+// rejects but the status poller used for waiting sets
+func ignoreEmptyFieldSelector(ctx context.Context, c ctrlClient.WithWatch, list ctrlClient.ObjectList, opts ...ctrlClient.ListOption) error {
+	listOptions := &ctrlClient.ListOptions{}
+	listOptions.ApplyOptions(opts)
+	if listOptions.FieldSelector != nil && listOptions.FieldSelector.Empty() {
+		listOptions.FieldSelector = nil
+	}
+	return c.List(ctx, list, listOptions)
+}
+
+// markEstablished sets conditions of CRDs that would be set by the API server,
+// otherwise waiting for CRDs would never complete
+func markEstablished(obj ctrlClient.Object) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok || u.GroupVersionKind() != crdGVK {
+		return
+	}
+	conditions := []any{}
+	for _, condition := range []string{"NamesAccepted", "Established"} {
+		conditions = append(conditions, map[string]any{
+			"type":   condition,
+			"status": "True",
+		})
+	}
+	_ = unstructured.SetNestedSlice(u.Object, conditions, "status", "conditions")
+}
@@ -0,0 +1,193 @@
+package fakeserver
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	klog "k8s.io/klog/v2"
+
+	"github.com/errordeveloper/kube-test-env/provider"
+	"github.com/errordeveloper/kube-test-env/provider/fake"
+)
+
+const (
+	Name              = "fakeserver"
+	ClusterNamePrefix = "kte-fakeserver-"
+)
+
+// Managed serves an in-memory API over HTTPS on localhost, unlike the fake provider
+// it can be used by code that only accepts a kubeconfig, as all clients talk to it
+// over real HTTP
+type Managed struct {
+	provider.Common[provider.Provider]
+
+	UUID uuid.UUID
+
+	*fake.Store
+
+	Server *httptest.Server
+
+	ArtifactDir string
+	Logger      klog.Logger
+
+	handler *Handler
+	// logLock guards logFile, which is written by concurrent requests
+	logLock sync.Mutex
+	logFile *os.File
+}
+
+var _ provider.Lifecycle = &Managed{}
+
+func init() {
+	provider.Register(Name, func(opts provider.Options) (provider.Lifecycle, error) {
+		if opts.Config != nil {
+			opts.Logger.Info("ignoring cluster config", "provider", Name, "config-type", fmt.Sprintf("%T", opts.Config))
+		}
+		return New(opts.ArtifactDir, opts.Logger), nil
+	})
+}
+
+func New(artifactDir string, logger klog.Logger) *Managed {
+	uuid := uuid.New()
+	k := &Managed{
+		UUID:        uuid,
+		Store:       fake.NewStore(),
+		ArtifactDir: artifactDir,
+		Logger:      logger.WithName("fakeserver-provider").WithValues("fakeserver-provider-uuid", uuid.String()),
+	}
+	k.Common = provider.NewCommon[provider.Provider](k, logger)
+	return k
+}
+
+func (k *Managed) ClusterName() string {
+	return ClusterNamePrefix + k.UUID.String()
+}
+
+func (k *Managed) KubeConfigPath() string {
+	return filepath.Join(k.ArtifactDir, k.ClusterName(), "kubeconfig")
+}
+
+func (k *Managed) LogsDir() string {
+	return filepath.Join(k.ArtifactDir, k.ClusterName(), "logs")
+}
+
+func (k *Managed) Create() error {
+	if err := os.MkdirAll(k.LogsDir(), 0o755); err != nil {
+		return err
+	}
+	logFile, err := os.Create(filepath.Join(k.LogsDir(), "requests.log"))
+	if err != nil {
+		return err
+	}
+	k.logFile = logFile
+
+	k.handler = NewHandler(k.Store, k.Logger)
+	k.Server = httptest.NewUnstartedServer(k.logRequests(k.handler))
+	k.Server.EnableHTTP2 = true
+	k.Server.StartTLS()
+
+	k.Logger.Info("Create(): started server", "cluster-name", k.ClusterName(), "url", k.Server.URL)
+
+	if err := k.writeKubeConfig(); err != nil {
+		return errors.Join(err, k.Delete())
+	}
+	return nil
+}
+
+func (k *Managed) writeKubeConfig() error {
+	caData := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: k.Server.Certificate().Raw,
+	})
+
+	name := k.ClusterName()
+	config := clientcmdapi.NewConfig()
+	config.Clusters[name] = &clientcmdapi.Cluster{
+		Server:                   k.Server.URL,
+		CertificateAuthorityData: caData,
+	}
+	config.AuthInfos[name] = &clientcmdapi.AuthInfo{
+		Token: "kte-fakeserver",
+	}
+	config.Contexts[name] = &clientcmdapi.Context{
+		Cluster:  name,
+		AuthInfo: name,
+	}
+	config.CurrentContext = name
+
+	return clientcmd.WriteToFile(*config, k.KubeConfigPath())
+}
+
+func (k *Managed) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		k.logLock.Lock()
+		if k.logFile != nil {
+			fmt.Fprintf(k.logFile, "%s %s %s\n", time.Now().Format(time.RFC3339Nano), r.Method, r.URL.String())
+		}
+		k.logLock.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (k *Managed) CollectLogs() error {
+	k.Logger.Info("CollectLogs(): syncing request log", "cluster-name", k.ClusterName())
+	k.logLock.Lock()
+	defer k.logLock.Unlock()
+	if k.logFile == nil {
+		return nil
+	}
+	return k.logFile.Sync()
+}
+
+func (k *Managed) Delete() error {
+	k.Logger.Info("Delete(): stopping server", "cluster-name", k.ClusterName())
+	// the server is shut down first, so that no request is logged after the log is closed
+	if k.Server != nil {
+		k.handler.Stop()
+		k.Server.CloseClientConnections()
+		k.Server.Close()
+		k.Server = nil
+	}
+	k.logLock.Lock()
+	defer k.logLock.Unlock()
+	if k.logFile != nil {
+		_ = k.logFile.Close()
+		k.logFile = nil
+	}
+	if err := os.Remove(k.KubeConfigPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (k *Managed) CreateContext(ctx context.Context) error {
+	return provider.RunContext(ctx, "Create", k.ClusterName(), func(ctx context.Context) error {
+		err := k.Create()
+		if ctx.Err() != nil && k.Server != nil {
+			if err := k.Delete(); err != nil {
+				k.Logger.Error(err, "failed to stop server")
+			}
+		}
+		return err
+	}, nil)
+}
+
+func (k *Managed) CollectLogsContext(ctx context.Context) error {
+	return provider.RunContext(ctx, "CollectLogs", k.ClusterName(), func(context.Context) error { return k.CollectLogs() }, nil)
+}
+
+func (k *Managed) DeleteContext(ctx context.Context) error {
+	return provider.RunContext(ctx, "Delete", k.ClusterName(), func(context.Context) error { return k.Delete() }, nil)
+}
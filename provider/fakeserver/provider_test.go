@@ -0,0 +1,207 @@
+package fakeserver_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	klog "k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"github.com/errordeveloper/kube-test-env/clients"
+	"github.com/errordeveloper/kube-test-env/provider/fakeserver"
+)
+
+const configMapManifest = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+  namespace: %s
+  labels:
+    app: test
+data:
+  foo: bar
+`
+
+func TestFakeServerCreateAccessDelete(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.Background()
+
+	log := klog.FromContext(ctx)
+
+	k := fakeserver.New(t.TempDir(), log)
+
+	g.Expect(k.Create()).To(Succeed())
+
+	t.Logf("Created cluster name=%q kubeconfig=%q", k.ClusterName(), k.KubeConfigPath())
+
+	g.Expect(k.KubeConfigPath()).To(BeAnExistingFile())
+
+	clientConfig, err := k.NewClientConfig()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(clientConfig.Host).To(HavePrefix("https://127.0.0.1:"))
+	g.Expect(clientConfig.TLSClientConfig.CAData).NotTo(BeEmpty())
+
+	maker, err := k.NewClientMaker()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	clientSet, err := maker.NewClientSet()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	{
+		groups, err := clientSet.Discovery().ServerGroups()
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(groups.Groups).NotTo(BeEmpty())
+
+		resources, err := clientSet.Discovery().ServerResourcesForGroupVersion("apps/v1")
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(resources.APIResources).To(ContainElement(HaveField("Name", "deployments")))
+	}
+
+	namespaced, err := maker.NewNamespacedClientMaker(ctx, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	{
+		client, err := namespaced.NewControllerRuntimeClient()
+		g.Expect(err).NotTo(HaveOccurred())
+
+		serviceAccounts := &corev1.ServiceAccountList{}
+		g.Expect(client.List(ctx, serviceAccounts, namespaced.DefaultControllerRuntimeListOptions)).To(Succeed())
+		g.Expect(serviceAccounts.Items).To(HaveLen(1))
+	}
+
+	{
+		watcher, err := clientSet.CoreV1().ConfigMaps(namespaced.Namespace).Watch(ctx, metav1.ListOptions{
+			LabelSelector: "app=test",
+		})
+		g.Expect(err).NotTo(HaveOccurred())
+		defer watcher.Stop()
+
+		rm, err := namespaced.NewResourceManager()
+		g.Expect(err).NotTo(HaveOccurred())
+
+		manifest := func() *bytes.Buffer {
+			return bytes.NewBufferString(fmt.Sprintf(configMapManifest, namespaced.Namespace))
+		}
+
+		changeSet, err := rm.ApplyManifest(ctx, nil, manifest())
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(string(changeSet.Entries[0].Action)).To(Equal("created"))
+
+		g.Eventually(watcher.ResultChan(), 5*time.Second).Should(Receive(HaveField("Type", watch.Added)))
+
+		configMap, err := clientSet.CoreV1().ConfigMaps(namespaced.Namespace).Get(ctx, "test", metav1.GetOptions{})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(configMap.Data).To(HaveKeyWithValue("foo", "bar"))
+
+		changeSet, err = rm.ApplyManifest(ctx, &clients.WaitOptions{Interval: 10 * time.Millisecond, Timeout: time.Second}, manifest())
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(string(changeSet.Entries[0].Action)).To(Equal("unchanged"))
+
+		g.Expect(clientSet.CoreV1().ConfigMaps(namespaced.Namespace).Delete(ctx, "test", metav1.DeleteOptions{})).To(Succeed())
+
+		g.Eventually(watcher.ResultChan(), 5*time.Second).Should(Receive(HaveField("Type", watch.Deleted)))
+	}
+
+	maker.Cleanup(ctx)
+
+	_, err = clientSet.CoreV1().Namespaces().Get(ctx, namespaced.Namespace, metav1.GetOptions{})
+	g.Expect(err).To(HaveOccurred())
+
+	g.Expect(k.CollectLogs()).To(Succeed())
+	g.Expect(k.Delete()).To(Succeed())
+	g.Expect(k.KubeConfigPath()).NotTo(BeAnExistingFile())
+}
+
+const crdManifest = `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  scope: Namespaced
+  names:
+    kind: Widget
+    listKind: WidgetList
+    plural: widgets
+    singular: widget
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        x-kubernetes-preserve-unknown-fields: true
+`
+
+func TestFakeServerCustomResources(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.Background()
+
+	k := fakeserver.New(t.TempDir(), klog.FromContext(ctx))
+	g.Expect(k.Create()).To(Succeed())
+	defer func() { g.Expect(k.Delete()).To(Succeed()) }()
+
+	clientConfig, err := k.NewClientConfig()
+	g.Expect(err).NotTo(HaveOccurred())
+	client, err := dynamic.NewForConfig(clientConfig)
+	g.Expect(err).NotTo(HaveOccurred())
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(clientConfig)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	_, err = discoveryClient.ServerResourcesForGroupVersion("example.com/v1")
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+	crd := &unstructured.Unstructured{}
+	g.Expect(yaml.Unmarshal([]byte(crdManifest), &crd.Object)).To(Succeed())
+	crds := schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+	_, err = client.Resource(crds).Create(ctx, crd, metav1.CreateOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	resources, err := discoveryClient.ServerResourcesForGroupVersion("example.com/v1")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(resources.APIResources).To(ConsistOf(And(HaveField("Name", "widgets"), HaveField("Namespaced", true))))
+
+	widgets := client.Resource(schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}).Namespace("default")
+
+	watcher, err := widgets.Watch(ctx, metav1.ListOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	defer watcher.Stop()
+
+	widget := &unstructured.Unstructured{}
+	widget.SetAPIVersion("example.com/v1")
+	widget.SetKind("Widget")
+	widget.SetName("test")
+	g.Expect(unstructured.SetNestedField(widget.Object, "bar", "spec", "foo")).To(Succeed())
+	_, err = widgets.Create(ctx, widget, metav1.CreateOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Eventually(watcher.ResultChan(), 5*time.Second).Should(Receive(HaveField("Type", watch.Added)))
+
+	list, err := widgets.List(ctx, metav1.ListOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(list.Items).To(HaveLen(1))
+	g.Expect(list.Items[0].Object).To(HaveKeyWithValue("spec", HaveKeyWithValue("foo", "bar")))
+
+	g.Expect(client.Resource(crds).Delete(ctx, crd.GetName(), metav1.DeleteOptions{})).To(Succeed())
+
+	_, err = widgets.List(ctx, metav1.ListOptions{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+}
@@ -0,0 +1,705 @@
+package fakeserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/apimachinery/pkg/watch"
+	klog "k8s.io/klog/v2"
+	ctrlClient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/errordeveloper/kube-test-env/provider/fake"
+)
+
+var verbs = metav1.Verbs{"create", "delete", "deletecollection", "get", "list", "patch", "update", "watch"}
+
+type resource struct {
+	gvk        schema.GroupVersionKind
+	namespaced bool
+}
+
+// apiResources is what discovery serves and what requests are routed by
+type apiResources struct {
+	resources map[schema.GroupVersionResource]resource
+	// versions of each group, in order of preference
+	groups map[string][]string
+	lists  map[schema.GroupVersion]*metav1.APIResourceList
+}
+
+// Handler serves a subset of the Kubernetes REST API from a fake.Store,
+// it supports discovery, CRUD, watch and (approximated) server-side apply
+// of the types known to the store's scheme and of custom resources defined
+// by CRDs in the store, using JSON only
+type Handler struct {
+	store  *fake.Store
+	logger klog.Logger
+
+	builtin *apiResources
+
+	stop chan struct{}
+}
+
+type request struct {
+	gvr         schema.GroupVersionResource
+	namespace   string
+	name        string
+	subresource string
+}
+
+func NewHandler(store *fake.Store, logger klog.Logger) *Handler {
+	h := &Handler{
+		store:   store,
+		logger:  logger,
+		builtin: newAPIResources(),
+		stop:    make(chan struct{}),
+	}
+
+	for gvk := range store.Scheme.AllKnownTypes() {
+		if gvk.Version == runtime.APIVersionInternal || strings.HasSuffix(gvk.Kind, "List") {
+			continue
+		}
+		// only kinds that have lists are resources, this excludes options and such
+		if !store.Scheme.Recognizes(gvk.GroupVersion().WithKind(gvk.Kind + "List")) {
+			continue
+		}
+		mapping, err := store.RESTMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			continue
+		}
+		namespaced := mapping.Scope.Name() == meta.RESTScopeNameNamespace
+		h.builtin.add(mapping.Resource, gvk, namespaced, strings.ToLower(gvk.Kind))
+	}
+	for group := range h.builtin.groups {
+		versions := []string{}
+		for _, gv := range store.Scheme.PrioritizedVersionsForGroup(group) {
+			if _, ok := h.builtin.lists[gv]; ok {
+				versions = append(versions, gv.Version)
+			}
+		}
+		h.builtin.groups[group] = versions
+	}
+	h.builtin.sort()
+	return h
+}
+
+func newAPIResources() *apiResources {
+	return &apiResources{
+		resources: map[schema.GroupVersionResource]resource{},
+		groups:    map[string][]string{},
+		lists:     map[schema.GroupVersion]*metav1.APIResourceList{},
+	}
+}
+
+func (a *apiResources) add(gvr schema.GroupVersionResource, gvk schema.GroupVersionKind, namespaced bool, singular string) {
+	a.resources[gvr] = resource{gvk: gvk, namespaced: namespaced}
+
+	gv := gvk.GroupVersion()
+	list, ok := a.lists[gv]
+	if !ok {
+		list = &metav1.APIResourceList{
+			TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+			GroupVersion: gv.String(),
+		}
+		a.lists[gv] = list
+		a.groups[gv.Group] = append(a.groups[gv.Group], gv.Version)
+	}
+	list.APIResources = append(list.APIResources, metav1.APIResource{
+		Name:         gvr.Resource,
+		SingularName: singular,
+		Namespaced:   namespaced,
+		Kind:         gvk.Kind,
+		Verbs:        verbs,
+	})
+}
+
+func (a *apiResources) sort() {
+	for _, list := range a.lists {
+		sort.Slice(list.APIResources, func(i, j int) bool {
+			return list.APIResources[i].Name < list.APIResources[j].Name
+		})
+	}
+}
+
+func (a *apiResources) clone() *apiResources {
+	c := newAPIResources()
+	for gvr, res := range a.resources {
+		c.resources[gvr] = res
+	}
+	for group, versions := range a.groups {
+		c.groups[group] = slices.Clone(versions)
+	}
+	for gv, list := range a.lists {
+		c.lists[gv] = list.DeepCopy()
+	}
+	return c
+}
+
+// apiResources returns the built-in resources along with the served versions of
+// all CRDs in the store, CRDs are read on every request, so that custom resources
+// are served as soon as their CRD is created and until it's deleted
+func (h *Handler) apiResources(ctx context.Context) (*apiResources, error) {
+	crds := &apiextensionsv1.CustomResourceDefinitionList{}
+	if err := h.store.Client.List(ctx, crds); err != nil {
+		return nil, err
+	}
+	if len(crds.Items) == 0 {
+		return h.builtin, nil
+	}
+	a := h.builtin.clone()
+	customGroups := map[string]bool{}
+	for _, crd := range crds.Items {
+		names := crd.Spec.Names
+		namespaced := crd.Spec.Scope == apiextensionsv1.NamespaceScoped
+		for _, v := range crd.Spec.Versions {
+			if !v.Served {
+				continue
+			}
+			gv := schema.GroupVersion{Group: crd.Spec.Group, Version: v.Name}
+			if _, ok := a.resources[gv.WithResource(names.Plural)]; ok {
+				continue
+			}
+			if _, ok := h.builtin.groups[gv.Group]; !ok {
+				customGroups[gv.Group] = true
+			}
+			a.add(gv.WithResource(names.Plural), gv.WithKind(names.Kind), namespaced, names.Singular)
+		}
+	}
+	for group := range customGroups {
+		sort.Slice(a.groups[group], func(i, j int) bool {
+			return version.CompareKubeAwareVersionStrings(a.groups[group][i], a.groups[group][j]) > 0
+		})
+	}
+	a.sort()
+	return a, nil
+}
+
+// Stop terminates all watches that are in progress
+func (h *Handler) Stop() { close(h.stop) }
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.logger.V(1).Info("request", "method", r.Method, "url", r.URL.String())
+
+	if r.URL.Path == "/version" {
+		h.writeJSON(w, http.StatusOK, &version.Info{
+			Major:      "1",
+			Minor:      "29",
+			GitVersion: "v1.29.0-kte-fakeserver",
+		})
+		return
+	}
+
+	a, err := h.apiResources(r.Context())
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/api":
+		h.writeJSON(w, http.StatusOK, &metav1.APIVersions{
+			TypeMeta: metav1.TypeMeta{Kind: "APIVersions"},
+			Versions: a.groups[""],
+			ServerAddressByClientCIDRs: []metav1.ServerAddressByClientCIDR{
+				{ClientCIDR: "0.0.0.0/0", ServerAddress: r.Host},
+			},
+		})
+	case r.URL.Path == "/apis":
+		h.writeJSON(w, http.StatusOK, a.groupList())
+	case parts[0] == "api" && len(parts) >= 2:
+		h.serveGroupVersion(w, r, a, schema.GroupVersion{Version: parts[1]}, parts[2:])
+	case parts[0] == "apis" && len(parts) == 2:
+		h.serveGroup(w, a, parts[1])
+	case parts[0] == "apis" && len(parts) >= 3:
+		h.serveGroupVersion(w, r, a, schema.GroupVersion{Group: parts[1], Version: parts[2]}, parts[3:])
+	default:
+		h.writeError(w, apierrors.NewNotFound(schema.GroupResource{}, r.URL.Path))
+	}
+}
+
+func (a *apiResources) groupList() *metav1.APIGroupList {
+	list := &metav1.APIGroupList{
+		TypeMeta: metav1.TypeMeta{Kind: "APIGroupList", APIVersion: "v1"},
+	}
+	names := []string{}
+	for name := range a.groups {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		list.Groups = append(list.Groups, *a.group(name))
+	}
+	return list
+}
+
+func (a *apiResources) group(name string) *metav1.APIGroup {
+	group := &metav1.APIGroup{
+		TypeMeta: metav1.TypeMeta{Kind: "APIGroup", APIVersion: "v1"},
+		Name:     name,
+	}
+	for _, v := range a.groups[name] {
+		version := metav1.GroupVersionForDiscovery{
+			GroupVersion: schema.GroupVersion{Group: name, Version: v}.String(),
+			Version:      v,
+		}
+		if len(group.Versions) == 0 {
+			group.PreferredVersion = version
+		}
+		group.Versions = append(group.Versions, version)
+	}
+	return group
+}
+
+func (h *Handler) serveGroup(w http.ResponseWriter, a *apiResources, name string) {
+	if _, ok := a.groups[name]; !ok {
+		h.writeError(w, apierrors.NewNotFound(schema.GroupResource{Group: name}, ""))
+		return
+	}
+	h.writeJSON(w, http.StatusOK, a.group(name))
+}
+
+func (h *Handler) serveGroupVersion(w http.ResponseWriter, r *http.Request, a *apiResources, gv schema.GroupVersion, parts []string) {
+	list, ok := a.lists[gv]
+	if !ok {
+		h.writeError(w, apierrors.NewNotFound(schema.GroupResource{Group: gv.Group}, gv.Version))
+		return
+	}
+	if len(parts) == 0 {
+		h.writeJSON(w, http.StatusOK, list)
+		return
+	}
+
+	req := &request{}
+	// namespaces/{name}/status is a subresource of a namespace, not a namespaced resource
+	if nested, ok := a.resources[gv.WithResource(elem(parts, 2))]; parts[0] == "namespaces" && ok && nested.namespaced {
+		req.namespace = parts[1]
+		parts = parts[2:]
+	}
+	req.gvr = gv.WithResource(parts[0])
+	req.name = elem(parts, 1)
+	req.subresource = elem(parts, 2)
+
+	res, ok := a.resources[req.gvr]
+	if !ok || len(parts) > 3 {
+		h.writeError(w, apierrors.NewNotFound(req.gvr.GroupResource(), req.name))
+		return
+	}
+	if !res.namespaced && req.namespace != "" {
+		h.writeError(w, apierrors.NewBadRequest(fmt.Sprintf("%s is not namespaced", req.gvr.Resource)))
+		return
+	}
+
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	switch {
+	case r.Method == http.MethodGet && req.name == "" && query.Get("watch") == "true":
+		h.watch(w, r, req, res)
+	case r.Method == http.MethodGet && req.name == "":
+		h.list(ctx, w, r, req, res)
+	case r.Method == http.MethodGet:
+		obj := newObject(res.gvk, req)
+		if err := h.store.Client.Get(ctx, ctrlClient.ObjectKeyFromObject(obj), obj); err != nil {
+			h.writeError(w, err)
+			return
+		}
+		h.writeJSON(w, http.StatusOK, obj)
+	case r.Method == http.MethodPost && req.name == "":
+		obj, err := h.readObject(r, res, req)
+		if err != nil {
+			h.writeError(w, err)
+			return
+		}
+		if err := h.store.Client.Create(ctx, obj, createOptions(query)...); err != nil {
+			h.writeError(w, err)
+			return
+		}
+		h.writeJSON(w, http.StatusCreated, obj)
+	case r.Method == http.MethodPut && req.name != "":
+		obj, err := h.readObject(r, res, req)
+		if err != nil {
+			h.writeError(w, err)
+			return
+		}
+		if req.subresource == "status" {
+			err = h.store.Client.Status().Update(ctx, obj)
+		} else {
+			err = h.store.Client.Update(ctx, obj, updateOptions(query)...)
+		}
+		if err != nil {
+			h.writeError(w, err)
+			return
+		}
+		h.writeJSON(w, http.StatusOK, obj)
+	case r.Method == http.MethodPatch && req.name != "":
+		h.patch(ctx, w, r, req, res)
+	case r.Method == http.MethodDelete && req.name == "":
+		obj := newObject(res.gvk, req)
+		selector, err := labels.Parse(query.Get("labelSelector"))
+		if err != nil {
+			h.writeError(w, apierrors.NewBadRequest(err.Error()))
+			return
+		}
+		opts := []ctrlClient.DeleteAllOfOption{ctrlClient.MatchingLabelsSelector{Selector: selector}}
+		if req.namespace != "" {
+			opts = append(opts, ctrlClient.InNamespace(req.namespace))
+		}
+		if err := h.store.Client.DeleteAllOf(ctx, obj, opts...); err != nil {
+			h.writeError(w, err)
+			return
+		}
+		h.writeStatus(w, http.StatusOK, &metav1.Status{Status: metav1.StatusSuccess})
+	case r.Method == http.MethodDelete:
+		obj := newObject(res.gvk, req)
+		if err := h.store.Client.Delete(ctx, obj); err != nil {
+			h.writeError(w, err)
+			return
+		}
+		h.writeStatus(w, http.StatusOK, &metav1.Status{
+			Status:  metav1.StatusSuccess,
+			Details: &metav1.StatusDetails{Name: req.name, Group: req.gvr.Group, Kind: req.gvr.Resource},
+		})
+	default:
+		h.writeError(w, apierrors.NewMethodNotSupported(req.gvr.GroupResource(), r.Method))
+	}
+}
+
+func (h *Handler) list(ctx context.Context, w http.ResponseWriter, r *http.Request, req *request, res resource) {
+	list, err := h.listObjects(ctx, r, req, res)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, list)
+}
+
+func (h *Handler) listObjects(ctx context.Context, r *http.Request, req *request, res resource) (*unstructured.UnstructuredList, error) {
+	matches, err := newMatcher(r, req)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(res.gvk.GroupVersion().WithKind(res.gvk.Kind + "List"))
+	opts := []ctrlClient.ListOption{}
+	if req.namespace != "" {
+		opts = append(opts, ctrlClient.InNamespace(req.namespace))
+	}
+	if err := h.store.Client.List(ctx, list, opts...); err != nil {
+		return nil, err
+	}
+
+	items := list.Items[:0]
+	for i := range list.Items {
+		if matches(&list.Items[i]) {
+			items = append(items, list.Items[i])
+		}
+	}
+	list.Items = items
+	return list, nil
+}
+
+func (h *Handler) watch(w http.ResponseWriter, r *http.Request, req *request, res resource) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	if timeout := query.Get("timeoutSeconds"); timeout != "" {
+		seconds, err := strconv.Atoi(timeout)
+		if err != nil {
+			h.writeError(w, apierrors.NewBadRequest(err.Error()))
+			return
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(seconds)*time.Second)
+		defer cancel()
+	}
+
+	matches, err := newMatcher(r, req)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	// the fake client stores objects under the resource name it guesses from the kind,
+	// which may not be the plural that is served, e.g. for custom resources
+	storedGVR, _ := meta.UnsafeGuessKindToResource(res.gvk)
+	watcher, err := h.store.Tracker.Watch(storedGVR, req.namespace)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	defer watcher.Stop()
+
+	// when no resource version is given, the state of the world is sent first
+	var initial []unstructured.Unstructured
+	if query.Get("resourceVersion") == "" {
+		list, err := h.listObjects(ctx, r, req, res)
+		if err != nil {
+			h.writeError(w, err)
+			return
+		}
+		initial = list.Items
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	send := func(eventType watch.EventType, obj *unstructured.Unstructured) bool {
+		if err := encoder.Encode(&metav1.WatchEvent{
+			Type:   string(eventType),
+			Object: runtime.RawExtension{Object: obj},
+		}); err != nil {
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+
+	for i := range initial {
+		if !send(watch.Added, &initial[i]) {
+			return
+		}
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.stop:
+			return
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return
+			}
+			obj, err := toUnstructured(event.Object, res.gvk)
+			if err != nil {
+				h.logger.Error(err, "failed to convert watch event object")
+				return
+			}
+			if !matches(obj) {
+				continue
+			}
+			if !send(event.Type, obj) {
+				return
+			}
+		}
+	}
+}
+
+func (h *Handler) patch(ctx context.Context, w http.ResponseWriter, r *http.Request, req *request, res resource) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.writeError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+	query := r.URL.Query()
+
+	patchType := types.PatchType(strings.Split(r.Header.Get("Content-Type"), ";")[0])
+
+	opts := []ctrlClient.PatchOption{}
+	if query.Get("dryRun") == metav1.DryRunAll {
+		opts = append(opts, ctrlClient.DryRunAll)
+	}
+	if fieldManager := query.Get("fieldManager"); fieldManager != "" {
+		opts = append(opts, ctrlClient.FieldOwner(fieldManager))
+	}
+
+	var obj *unstructured.Unstructured
+	var patch ctrlClient.Patch
+	switch patchType {
+	case types.ApplyPatchType:
+		obj, err = decodeObject(body, res, req)
+		if err != nil {
+			h.writeError(w, err)
+			return
+		}
+		patch = ctrlClient.Apply
+	case types.JSONPatchType, types.MergePatchType, types.StrategicMergePatchType:
+		obj = newObject(res.gvk, req)
+		patch = ctrlClient.RawPatch(patchType, body)
+	default:
+		h.writeError(w, apierrors.NewGenericServerResponse(http.StatusUnsupportedMediaType, "patch",
+			req.gvr.GroupResource(), req.name, fmt.Sprintf("unsupported patch type %q", patchType), 0, false))
+		return
+	}
+
+	if req.subresource == "status" {
+		err = h.store.Client.Status().Patch(ctx, obj, patch)
+	} else {
+		err = h.store.Client.Patch(ctx, obj, patch, opts...)
+	}
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, obj)
+}
+
+func (h *Handler) readObject(r *http.Request, res resource, req *request) (*unstructured.Unstructured, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	return decodeObject(body, res, req)
+}
+
+func decodeObject(body []byte, res resource, req *request) (*unstructured.Unstructured, error) {
+	obj := &unstructured.Unstructured{}
+	// YAML is a superset of JSON, apply patches may come in either form
+	if err := yaml.Unmarshal(body, &obj.Object); err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	if obj.Object == nil {
+		return nil, apierrors.NewBadRequest("empty request body")
+	}
+	if obj.GetKind() == "" {
+		obj.SetGroupVersionKind(res.gvk)
+	}
+	if obj.GroupVersionKind() != res.gvk {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("%s doesn't match %s", obj.GroupVersionKind(), res.gvk))
+	}
+	if req.namespace != "" {
+		if obj.GetNamespace() != "" && obj.GetNamespace() != req.namespace {
+			return nil, apierrors.NewBadRequest("namespace of the object doesn't match the request")
+		}
+		obj.SetNamespace(req.namespace)
+	}
+	if req.name != "" {
+		if obj.GetName() != "" && obj.GetName() != req.name {
+			return nil, apierrors.NewBadRequest("name of the object doesn't match the request")
+		}
+		obj.SetName(req.name)
+	}
+	return obj, nil
+}
+
+func newObject(gvk schema.GroupVersionKind, req *request) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetNamespace(req.namespace)
+	obj.SetName(req.name)
+	return obj
+}
+
+// newMatcher implements label and field selectors, the latter are limited
+// to metadata.name and metadata.namespace
+func newMatcher(r *http.Request, req *request) (func(*unstructured.Unstructured) bool, error) {
+	query := r.URL.Query()
+
+	labelSelector, err := labels.Parse(query.Get("labelSelector"))
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	fieldSelector, err := fields.ParseSelector(query.Get("fieldSelector"))
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	for _, requirement := range fieldSelector.Requirements() {
+		switch requirement.Field {
+		case "metadata.name", "metadata.namespace":
+		default:
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("field selector %q is not supported", requirement.Field))
+		}
+	}
+
+	return func(obj *unstructured.Unstructured) bool {
+		if req.namespace != "" && obj.GetNamespace() != req.namespace {
+			return false
+		}
+		return labelSelector.Matches(labels.Set(obj.GetLabels())) &&
+			fieldSelector.Matches(fields.Set{
+				"metadata.name":      obj.GetName(),
+				"metadata.namespace": obj.GetNamespace(),
+			})
+	}, nil
+}
+
+func toUnstructured(obj runtime.Object, gvk schema.GroupVersionKind) (*unstructured.Unstructured, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u, nil
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(gvk)
+	return u, nil
+}
+
+func createOptions(query map[string][]string) []ctrlClient.CreateOption {
+	if dryRun, ok := query["dryRun"]; ok && len(dryRun) > 0 && dryRun[0] == metav1.DryRunAll {
+		return []ctrlClient.CreateOption{ctrlClient.DryRunAll}
+	}
+	return nil
+}
+
+func updateOptions(query map[string][]string) []ctrlClient.UpdateOption {
+	if dryRun, ok := query["dryRun"]; ok && len(dryRun) > 0 && dryRun[0] == metav1.DryRunAll {
+		return []ctrlClient.UpdateOption{ctrlClient.DryRunAll}
+	}
+	return nil
+}
+
+func elem(parts []string, i int) string {
+	if i < len(parts) {
+		return parts[i]
+	}
+	return ""
+}
+
+func (h *Handler) writeJSON(w http.ResponseWriter, code int, obj any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(obj); err != nil {
+		h.logger.Error(err, "failed to write response")
+	}
+}
+
+func (h *Handler) writeStatus(w http.ResponseWriter, code int, status *metav1.Status) {
+	status.TypeMeta = metav1.TypeMeta{Kind: "Status", APIVersion: "v1"}
+	status.Code = int32(code)
+	h.writeJSON(w, code, status)
+}
+
+func (h *Handler) writeError(w http.ResponseWriter, err error) {
+	if status, ok := err.(apierrors.APIStatus); ok {
+		s := status.Status()
+		h.writeStatus(w, int(s.Code), &s)
+		return
+	}
+	h.writeStatus(w, http.StatusInternalServerError, &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Message: err.Error(),
+		Reason:  metav1.StatusReasonInternalError,
+	})
+}
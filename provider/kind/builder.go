@@ -0,0 +1,311 @@
+package kind
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+
+	configv1alpha4 "sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
+)
+
+type (
+	Mount       = configv1alpha4.Mount
+	PortMapping = configv1alpha4.PortMapping
+	ProxyMode   = configv1alpha4.ProxyMode
+	IPFamily    = configv1alpha4.ClusterIPFamily
+)
+
+const (
+	IPv4Family      = configv1alpha4.IPv4Family
+	IPv6Family      = configv1alpha4.IPv6Family
+	DualStackFamily = configv1alpha4.DualStackFamily
+
+	IPTablesProxyMode = configv1alpha4.IPTablesProxyMode
+	IPVSProxyMode     = configv1alpha4.IPVSProxyMode
+)
+
+// ClusterBuilder builds a Cluster, errors are accumulated and returned by Build,
+// a single control-plane node is added if no nodes were added
+type ClusterBuilder struct {
+	cluster Cluster
+	errs    []error
+}
+
+type NodeOption func(*Node)
+
+func NewClusterBuilder() *ClusterBuilder {
+	return &ClusterBuilder{}
+}
+
+func (b *ClusterBuilder) errorf(format string, args ...any) *ClusterBuilder {
+	b.errs = append(b.errs, fmt.Errorf(format, args...))
+	return b
+}
+
+func (b *ClusterBuilder) ControlPlanes(n int, opts ...NodeOption) *ClusterBuilder {
+	return b.nodes(ControlPlaneRole, n, opts)
+}
+
+func (b *ClusterBuilder) Workers(n int, opts ...NodeOption) *ClusterBuilder {
+	return b.nodes(WorkerRole, n, opts)
+}
+
+func (b *ClusterBuilder) nodes(role configv1alpha4.NodeRole, n int, opts []NodeOption) *ClusterBuilder {
+	if n < 0 {
+		return b.errorf("number of %s nodes cannot be negative, got %d", role, n)
+	}
+	for i := 0; i < n; i++ {
+		node := Node{Role: role}
+		for _, opt := range opts {
+			opt(&node)
+		}
+		b.cluster.Nodes = append(b.cluster.Nodes, node)
+	}
+	return b
+}
+
+func (b *ClusterBuilder) FeatureGate(name string, enabled bool) *ClusterBuilder {
+	if b.cluster.FeatureGates == nil {
+		b.cluster.FeatureGates = map[string]bool{}
+	}
+	if current, ok := b.cluster.FeatureGates[name]; ok && current != enabled {
+		return b.errorf("feature gate %q is both enabled and disabled", name)
+	}
+	b.cluster.FeatureGates[name] = enabled
+	return b
+}
+
+// RuntimeConfig sets an API server '--runtime-config' entry, e.g. 'api/alpha' to 'true'
+func (b *ClusterBuilder) RuntimeConfig(key, value string) *ClusterBuilder {
+	if b.cluster.RuntimeConfig == nil {
+		b.cluster.RuntimeConfig = map[string]string{}
+	}
+	if current, ok := b.cluster.RuntimeConfig[key]; ok && current != value {
+		return b.errorf("runtime config %q is set to both %q and %q", key, current, value)
+	}
+	b.cluster.RuntimeConfig[key] = value
+	return b
+}
+
+func (b *ClusterBuilder) KubeadmConfigPatch(patch string) *ClusterBuilder {
+	b.cluster.KubeadmConfigPatches = append(b.cluster.KubeadmConfigPatches, patch)
+	return b
+}
+
+func (b *ClusterBuilder) ContainerdConfigPatch(patch string) *ClusterBuilder {
+	b.cluster.ContainerdConfigPatches = append(b.cluster.ContainerdConfigPatches, patch)
+	return b
+}
+
+func (b *ClusterBuilder) IPFamily(family IPFamily) *ClusterBuilder {
+	b.cluster.Networking.IPFamily = family
+	return b
+}
+
+func (b *ClusterBuilder) PodSubnet(cidr string) *ClusterBuilder {
+	b.cluster.Networking.PodSubnet = cidr
+	return b
+}
+
+func (b *ClusterBuilder) ServiceSubnet(cidr string) *ClusterBuilder {
+	b.cluster.Networking.ServiceSubnet = cidr
+	return b
+}
+
+func (b *ClusterBuilder) APIServerPort(port int32) *ClusterBuilder {
+	b.cluster.Networking.APIServerPort = port
+	return b
+}
+
+func (b *ClusterBuilder) KubeProxyMode(mode ProxyMode) *ClusterBuilder {
+	b.cluster.Networking.KubeProxyMode = mode
+	return b
+}
+
+// DisableDefaultCNI is for installing a different CNI, nodes won't become ready until it's installed
+func (b *ClusterBuilder) DisableDefaultCNI() *ClusterBuilder {
+	b.cluster.Networking.DisableDefaultCNI = true
+	return b
+}
+
+func WithNodeImage(image string) NodeOption {
+	return func(n *Node) { n.Image = image }
+}
+
+func WithNodeLabel(key, value string) NodeOption {
+	return func(n *Node) {
+		if n.Labels == nil {
+			n.Labels = map[string]string{}
+		}
+		n.Labels[key] = value
+	}
+}
+
+func WithExtraMount(hostPath, containerPath string, readOnly bool) NodeOption {
+	return func(n *Node) {
+		n.ExtraMounts = append(n.ExtraMounts, Mount{HostPath: hostPath, ContainerPath: containerPath, Readonly: readOnly})
+	}
+}
+
+func WithPortMapping(containerPort, hostPort int32) NodeOption {
+	return func(n *Node) {
+		n.ExtraPortMappings = append(n.ExtraPortMappings, PortMapping{ContainerPort: containerPort, HostPort: hostPort})
+	}
+}
+
+func WithNodeKubeadmConfigPatch(patch string) NodeOption {
+	return func(n *Node) { n.KubeadmConfigPatches = append(n.KubeadmConfigPatches, patch) }
+}
+
+// taintsPatchHeader marks the patch that holds all taints of a node, as kubeadm patches
+// replace lists, so there has to be only one
+const taintsPatchHeader = "# taints set by WithNodeTaint\n"
+
+type joinConfigurationPatch struct {
+	Kind             string `json:"kind"`
+	NodeRegistration struct {
+		Taints []corev1.Taint `json:"taints"`
+	} `json:"nodeRegistration"`
+}
+
+// WithNodeTaint taints the node when it joins the cluster, so it has no effect on
+// the first control-plane node
+func WithNodeTaint(key, value string, effect corev1.TaintEffect) NodeOption {
+	return func(n *Node) {
+		patch := joinConfigurationPatch{Kind: "JoinConfiguration"}
+		i := slices.IndexFunc(n.KubeadmConfigPatches, func(p string) bool { return strings.HasPrefix(p, taintsPatchHeader) })
+		if i < 0 {
+			i = len(n.KubeadmConfigPatches)
+			n.KubeadmConfigPatches = append(n.KubeadmConfigPatches, "")
+		} else {
+			_ = yaml.Unmarshal([]byte(n.KubeadmConfigPatches[i]), &patch)
+		}
+		patch.NodeRegistration.Taints = append(patch.NodeRegistration.Taints, corev1.Taint{Key: key, Value: value, Effect: effect})
+		data, _ := yaml.Marshal(patch)
+		n.KubeadmConfigPatches[i] = taintsPatchHeader + string(data)
+	}
+}
+
+// nodeTaints returns taints set by WithNodeTaint
+func nodeTaints(n *Node) []corev1.Taint {
+	for _, p := range n.KubeadmConfigPatches {
+		if strings.HasPrefix(p, taintsPatchHeader) {
+			patch := joinConfigurationPatch{}
+			_ = yaml.Unmarshal([]byte(p), &patch)
+			return patch.NodeRegistration.Taints
+		}
+	}
+	return nil
+}
+
+// Build validates the config and returns a copy of it
+func (b *ClusterBuilder) Build() (*Cluster, error) {
+	cluster := b.cluster.DeepCopy()
+	cluster.Kind = "Cluster"
+	cluster.APIVersion = "kind.x-k8s.io/v1alpha4"
+	if len(cluster.Nodes) == 0 {
+		cluster.Nodes = []Node{{Role: ControlPlaneRole}}
+	}
+	errs := append([]error{}, b.errs...)
+	errs = append(errs, validateCluster(cluster)...)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid cluster config: %w", errors.Join(errs...))
+	}
+	return cluster, nil
+}
+
+// Render returns YAML of the config as it would be passed to kind
+func (b *ClusterBuilder) Render() ([]byte, error) {
+	cluster, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(cluster)
+}
+
+func validateCluster(cluster *Cluster) []error {
+	errs := []error{}
+
+	hasControlPlane := false
+	hostPorts := map[string]int{}
+	if port := cluster.Networking.APIServerPort; port != 0 {
+		hostPorts[fmt.Sprintf("%s:%d/%s", cluster.Networking.APIServerAddress, port, "TCP")] = -1
+	}
+	for i, node := range cluster.Nodes {
+		if node.Role == ControlPlaneRole {
+			hasControlPlane = true
+		}
+		for key := range node.Labels {
+			for _, msg := range validation.IsQualifiedName(key) {
+				errs = append(errs, fmt.Errorf("node %d: invalid label %q: %s", i, key, msg))
+			}
+		}
+		containerPaths := map[string]bool{}
+		for _, mount := range node.ExtraMounts {
+			if !filepath.IsAbs(mount.HostPath) {
+				errs = append(errs, fmt.Errorf("node %d: host path of mount %q must be absolute", i, mount.HostPath))
+			}
+			if containerPaths[mount.ContainerPath] {
+				errs = append(errs, fmt.Errorf("node %d: container path %q is mounted more than once", i, mount.ContainerPath))
+			}
+			containerPaths[mount.ContainerPath] = true
+		}
+		for _, mapping := range node.ExtraPortMappings {
+			if mapping.HostPort == 0 {
+				// random port
+				continue
+			}
+			protocol := mapping.Protocol
+			if protocol == "" {
+				protocol = configv1alpha4.PortMappingProtocolTCP
+			}
+			key := fmt.Sprintf("%s:%d/%s", mapping.ListenAddress, mapping.HostPort, protocol)
+			if other, ok := hostPorts[key]; ok {
+				if other < 0 {
+					errs = append(errs, fmt.Errorf("node %d: host port %d is used by the API server", i, mapping.HostPort))
+				} else {
+					errs = append(errs, fmt.Errorf("node %d: host port %d is already mapped on node %d", i, mapping.HostPort, other))
+				}
+				continue
+			}
+			hostPorts[key] = i
+		}
+	}
+	if !hasControlPlane {
+		errs = append(errs, errors.New("at least one control-plane node is required"))
+	}
+
+	for _, subnet := range []struct{ name, cidr string }{
+		{"pod", cluster.Networking.PodSubnet},
+		{"service", cluster.Networking.ServiceSubnet},
+	} {
+		name, cidr := subnet.name, subnet.cidr
+		if cidr == "" || cluster.Networking.IPFamily == DualStackFamily {
+			continue
+		}
+		ip, _, err := net.ParseCIDR(cidr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s subnet %q: %w", name, cidr, err))
+			continue
+		}
+		isIPv6 := ip.To4() == nil
+		switch cluster.Networking.IPFamily {
+		case "", IPv4Family:
+			if isIPv6 {
+				errs = append(errs, fmt.Errorf("%s subnet %q is IPv6, but IP family is IPv4", name, cidr))
+			}
+		case IPv6Family:
+			if !isIPv6 {
+				errs = append(errs, fmt.Errorf("%s subnet %q is IPv4, but IP family is IPv6", name, cidr))
+			}
+		}
+	}
+	return errs
+}
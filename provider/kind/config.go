@@ -0,0 +1,171 @@
+package kind
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	klog "k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"github.com/errordeveloper/kube-test-env/addons"
+)
+
+const (
+	// EnvConfig points to a config file, otherwise ConfigFileName is looked up in testdata
+	// of the current directory and its parents up to the root of the module
+	EnvConfig      = "KTE_CONFIG"
+	ConfigFileName = "kte.yaml"
+)
+
+// Config is read from a file, fields that are set take precedence over values set in code,
+// i.e. SharedConfig, SharedTimeout, MainOptions and arguments of ForTest; Addons and Retain
+// are only applied by Main and ForTest, as Shared neither installs addons nor retains clusters
+type Config struct {
+	Cluster *Cluster `json:"cluster,omitempty"`
+	// NodeImage and KubernetesVersion are mutually exclusive, the latter is
+	// looked up in NodeImageCatalog
+	NodeImage         string `json:"nodeImage,omitempty"`
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+
+	Addons        *addons.Config   `json:"addons,omitempty"`
+	LocalRegistry *LocalRegistry   `json:"localRegistry,omitempty"`
+	Retain        RetainPolicy     `json:"retain,omitempty"`
+	Timeout       *metav1.Duration `json:"timeout,omitempty"`
+
+	path string
+}
+
+// LoadConfig reads and validates a config file, unknown fields are treated as errors
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("invalid config file %q: %w", path, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %q: %w", path, err)
+	}
+	config.path = path
+	return config, nil
+}
+
+// ConfigFromEnv loads the file set by EnvConfig or found in testdata, it returns an empty
+// config if there is no file
+func ConfigFromEnv() (*Config, error) {
+	if path := os.Getenv(EnvConfig); path != "" {
+		return LoadConfig(path)
+	}
+	path, err := findConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return &Config{}, nil
+	}
+	return LoadConfig(path)
+}
+
+func findConfigFile() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, "testdata", ConfigFileName)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return "", nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+func (c *Config) validate() error {
+	errs := []error{}
+	if c.NodeImage != "" && c.KubernetesVersion != "" {
+		errs = append(errs, errors.New("nodeImage and kubernetesVersion are mutually exclusive"))
+	}
+	if c.KubernetesVersion != "" {
+		if _, err := NodeImageFor(c.KubernetesVersion); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.Cluster != nil && len(c.Cluster.Nodes) > 0 {
+		errs = append(errs, validateCluster(c.Cluster)...)
+	}
+	if err := c.Retain.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Timeout != nil && c.Timeout.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("timeout must be positive, got %s", c.Timeout.Duration))
+	}
+	return errors.Join(errs...)
+}
+
+// logOverrides logs which of the given fields set in code are replaced by the file,
+// fields are named as in the file
+func (c *Config) logOverrides(logger klog.Logger, setInCode ...string) {
+	setInFile := map[string]bool{
+		"cluster": c.Cluster != nil,
+		"addons":  c.Addons != nil,
+		"retain":  c.Retain != "",
+		"timeout": c.Timeout != nil,
+	}
+	overridden := []string{}
+	for _, field := range setInCode {
+		if setInFile[field] {
+			overridden = append(overridden, field)
+		}
+	}
+	if len(overridden) > 0 {
+		logger.Info("config file overrides values set in code", "config-file", c.path, "fields", overridden)
+	}
+}
+
+func (c *Config) clusterOr(config *Cluster) *Cluster {
+	if c.Cluster != nil {
+		return c.Cluster
+	}
+	return config
+}
+
+func (c *Config) timeoutOr(timeout time.Duration) time.Duration {
+	if c.Timeout != nil {
+		return c.Timeout.Duration
+	}
+	return timeout
+}
+
+// applyTo sets node image and local registry, which only apply to managed clusters
+func (c *Config) applyTo(k KindLifecycle) {
+	managed, ok := k.(*Managed)
+	if !ok {
+		return
+	}
+	switch {
+	case c.NodeImage != "":
+		managed.NodeImage = c.NodeImage
+	case c.KubernetesVersion != "":
+		// already validated
+		managed.NodeImage, _ = NodeImageFor(c.KubernetesVersion)
+	}
+	if c.LocalRegistry != nil {
+		localRegistry := *c.LocalRegistry
+		managed.LocalRegistry = &localRegistry
+	}
+}
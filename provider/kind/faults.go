@@ -0,0 +1,154 @@
+package kind
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+)
+
+// FaultsLogName is the file in the artifact directory where all fault injection
+// actions are recorded, so that test failures can be correlated with them
+const FaultsLogName = "faults.log"
+
+func (k *Managed) FaultsLogPath() string {
+	return filepath.Join(k.ArtifactDir, k.ClusterName(), FaultsLogName)
+}
+
+// recordFault logs the action and appends it to the faults log
+func (k *Managed) recordFault(action, node string, err error) {
+	result := "ok"
+	if err != nil {
+		result = err.Error()
+	}
+	k.Logger.Info("Faults(): "+action, "kind-cluster-name", k.ClusterName(), "node", node, "result", result)
+
+	if err := os.MkdirAll(filepath.Dir(k.FaultsLogPath()), 0o755); err != nil {
+		k.Logger.Error(err, "failed to record fault", "path", k.FaultsLogPath())
+		return
+	}
+	f, err := os.OpenFile(k.FaultsLogPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		k.Logger.Error(err, "failed to record fault", "path", k.FaultsLogPath())
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "%s\t%s\t%s\t%s\n", time.Now().UTC().Format(time.RFC3339Nano), action, node, result)
+}
+
+// node returns the node of this cluster by name, which is the same as the name
+// of the container and the name of the Kubernetes node
+func (k *Managed) node(name string) (nodes.Node, error) {
+	all, err := k.Provider.ListNodes(k.ClusterName())
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range all {
+		if node.String() == name {
+			return node, nil
+		}
+	}
+	return nil, fmt.Errorf("node %q not found in cluster %q", name, k.ClusterName())
+}
+
+func (k *Managed) dockerNodeAction(ctx context.Context, action, name string) error {
+	if _, err := k.node(name); err != nil {
+		return err
+	}
+	out, err := exec.CommandContext(ctx, "docker", action, name).CombinedOutput()
+	if err != nil {
+		err = fmt.Errorf("failed to %s node %q: %w: %s", action, name, err, out)
+	}
+	k.recordFault(action, name, err)
+	return err
+}
+
+func (k *Managed) restartService(ctx context.Context, service, name string) error {
+	node, err := k.node(name)
+	if err != nil {
+		return err
+	}
+	err = node.CommandContext(ctx, "systemctl", "restart", service).Run()
+	if err != nil {
+		err = fmt.Errorf("failed to restart %s on node %q: %w", service, name, err)
+	}
+	k.recordFault("restart-"+service, name, err)
+	return err
+}
+
+// StopNode stops the node container, the node becomes NotReady once the node
+// monitor grace period of the controller manager lapses
+func (k *Managed) StopNode(ctx context.Context, name string) error {
+	return k.dockerNodeAction(ctx, "stop", name)
+}
+
+func (k *Managed) StartNode(ctx context.Context, name string) error {
+	return k.dockerNodeAction(ctx, "start", name)
+}
+
+// PauseNode freezes all processes of the node container, unlike StopNode
+// its network interfaces remain up
+func (k *Managed) PauseNode(ctx context.Context, name string) error {
+	return k.dockerNodeAction(ctx, "pause", name)
+}
+
+func (k *Managed) UnpauseNode(ctx context.Context, name string) error {
+	return k.dockerNodeAction(ctx, "unpause", name)
+}
+
+func (k *Managed) RestartKubelet(ctx context.Context, name string) error {
+	return k.restartService(ctx, "kubelet", name)
+}
+
+func (k *Managed) RestartContainerd(ctx context.Context, name string) error {
+	return k.restartService(ctx, "containerd", name)
+}
+
+// WaitForNodeReady waits until the Ready condition of the node is True, or until
+// it's not True if ready is false
+func (k *Managed) WaitForNodeReady(ctx context.Context, name string, ready bool) error {
+	err := k.waitForNodeReady(ctx, name, ready)
+	k.recordFault(fmt.Sprintf("wait-ready=%v", ready), name, err)
+	return err
+}
+
+func (k *Managed) waitForNodeReady(ctx context.Context, name string, ready bool) error {
+	clientMaker, err := k.NewClientMaker()
+	if err != nil {
+		return err
+	}
+	clientSet, err := clientMaker.NewClientSet()
+	if err != nil {
+		return err
+	}
+	err = wait.PollUntilContextCancel(ctx, time.Second, true, func(ctx context.Context) (bool, error) {
+		node, err := clientSet.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			// API server may be unavailable while control-plane node is down,
+			// and new nodes are not registered straight away
+			return false, nil
+		}
+		return isNodeReady(node) == ready, nil
+	})
+	if err != nil {
+		return fmt.Errorf("timed out waiting for node %q to become ready=%v: %w", name, ready, err)
+	}
+	return nil
+}
+
+func isNodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package kind
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+
+	"github.com/errordeveloper/kube-test-env/clients"
+	"github.com/errordeveloper/kube-test-env/provider"
+)
+
+// ForTest creates a cluster that is deleted when t completes, if t failed
+// cluster logs are collected first into a directory named after the test;
+// values set in the config file take precedence over config, the cluster
+// is retained according to the policy set in the config file or EnvRetain
+func ForTest(t testing.TB, config *Cluster) KindLifecycle {
+	t.Helper()
+	return forTest(t, config, "")
+}
+
+func forTest(t testing.TB, config *Cluster, nodeImage string) KindLifecycle {
+	t.Helper()
+
+	logger := testr.NewWithInterface(t, testr.Options{})
+	artifactDir := filepath.Join(defaultArtifactDir(), clients.NameForTest(t, 128))
+
+	fileConfig, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	if config != nil {
+		fileConfig.logOverrides(logger, "cluster")
+	}
+
+	k := New(artifactDir, logger)
+	fileConfig.applyTo(k)
+	if nodeImage != "" {
+		managed, ok := k.(*Managed)
+		if !ok {
+			t.Skipf("cannot use node image %q with a cluster that is not managed", nodeImage)
+		}
+		managed.NodeImage = nodeImage
+	}
+
+	ctx := context.Background()
+	if deadline, ok := testDeadline(t); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	if fileConfig.Timeout != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, fileConfig.Timeout.Duration)
+		defer cancel()
+	}
+
+	if err := k.CreateContext(ctx, fileConfig.clusterOr(config)); err != nil {
+		t.Fatalf("failed to create cluster for test: %v", err)
+	}
+	t.Logf("Created cluster name=%q kubeconfig=%q", k.ClusterName(), k.KubeConfigPath())
+
+	retain, err := retainPolicyFromEnv(fileConfig, RetainNever)
+	if err != nil {
+		t.Fatalf("failed to determine retain policy: %v", err)
+	}
+	t.Cleanup(func() {
+		if t.Failed() {
+			if err := k.CollectLogs(); err != nil {
+				t.Logf("failed to collect logs: %v", err)
+			} else if dir := k.LogsDir(); dir != "" {
+				t.Logf("Collected logs into %q", dir)
+			}
+		}
+		if retain.retain(t.Failed()) {
+			message, err := retainIfManaged(k)
+			if err == nil {
+				t.Log(message)
+				return
+			}
+			t.Logf("failed to retain cluster: %v", err)
+		}
+		if err := k.Delete(); err != nil {
+			t.Errorf("failed to delete cluster %q: %v", k.ClusterName(), err)
+		}
+	})
+
+	if fileConfig.Addons != nil {
+		if err := k.ApplyAddons(ctx, *fileConfig.Addons); err != nil {
+			t.Fatalf("failed to apply addons: %v", err)
+		}
+	}
+	return k
+}
+
+// testDeadline leaves some time before the test times out for collecting logs
+func testDeadline(t testing.TB) (time.Time, bool) {
+	d, ok := t.(interface{ Deadline() (time.Time, bool) })
+	if !ok {
+		return time.Time{}, false
+	}
+	deadline, ok := d.Deadline()
+	if !ok {
+		return time.Time{}, false
+	}
+	return deadline.Add(-provider.CancelGracePeriod), true
+}
@@ -0,0 +1,235 @@
+package kind
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	klog "k8s.io/klog/v2"
+
+	"sigs.k8s.io/kind/pkg/cluster"
+
+	"github.com/errordeveloper/kube-test-env/provider/kind/log"
+)
+
+const EnvStateDir = "KTE_STATE_DIR"
+
+// StateDir is where metadata of each managed cluster is recorded on creation,
+// so that GC can tell which clusters have been orphaned
+var StateDir = stateDirFromEnv()
+
+func stateDirFromEnv() string {
+	if dir := os.Getenv(EnvStateDir); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "kte", "clusters")
+}
+
+type ClusterMetadata struct {
+	Name           string    `json:"name"`
+	Created        time.Time `json:"created"`
+	PID            int       `json:"pid"`
+	Hostname       string    `json:"hostname"`
+	Package        string    `json:"package"`
+	WorkDir        string    `json:"workDir"`
+	KubeConfigPath string    `json:"kubeconfigPath"`
+	StateFile      string    `json:"stateFile,omitempty"`
+
+	ConfigHash string     `json:"configHash,omitempty"`
+	ReuseUntil *time.Time `json:"reuseUntil,omitempty"`
+
+	Retained bool `json:"retained,omitempty"`
+}
+
+func metadataPath(name string) string { return filepath.Join(StateDir, name+".json") }
+
+func (k *Managed) newMetadata() *ClusterMetadata {
+	hostname, _ := os.Hostname()
+	workDir, _ := os.Getwd()
+	md := &ClusterMetadata{
+		Name:           k.ClusterName(),
+		Created:        time.Now(),
+		PID:            os.Getpid(),
+		Hostname:       hostname,
+		Package:        strings.TrimSuffix(filepath.Base(os.Args[0]), ".test"),
+		WorkDir:        workDir,
+		KubeConfigPath: k.KubeConfigPath(),
+		StateFile:      k.StateFile,
+		ConfigHash:     k.configHashValue,
+	}
+	if k.Reuse != nil {
+		reuseUntil := md.Created.Add(k.reuseTTL())
+		md.ReuseUntil = &reuseUntil
+	}
+	return md
+}
+
+func writeMetadata(md *ClusterMetadata) error {
+	if err := os.MkdirAll(StateDir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := metadataPath(md.Name) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, metadataPath(md.Name))
+}
+
+// ReadMetadata returns nil if no metadata was recorded for the cluster
+func ReadMetadata(name string) (*ClusterMetadata, error) {
+	data, err := os.ReadFile(metadataPath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	md := &ClusterMetadata{}
+	if err := json.Unmarshal(data, md); err != nil {
+		return nil, fmt.Errorf("cannot parse metadata file %q: %w", metadataPath(name), err)
+	}
+	return md, nil
+}
+
+func removeMetadata(name string) error {
+	if err := os.Remove(metadataPath(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (k *Managed) recordMetadata() {
+	if err := writeMetadata(k.newMetadata()); err != nil {
+		k.Logger.Error(err, "failed to record cluster metadata", "kind-cluster-name", k.ClusterName(), "state-dir", StateDir)
+	}
+}
+
+func (k *Managed) forgetMetadata() {
+	if err := removeMetadata(k.ClusterName()); err != nil {
+		k.Logger.Error(err, "failed to remove cluster metadata", "kind-cluster-name", k.ClusterName(), "state-dir", StateDir)
+	}
+}
+
+type GCOptions struct {
+	// TTL is the maximum age of a cluster, zero means clusters are only deleted
+	// once their owner has gone away
+	TTL time.Duration
+	// DeleteUntracked deletes clusters for which there is no metadata in StateDir,
+	// e.g. ones created by older versions or on a different host
+	DeleteUntracked bool
+	// DeleteRetained deletes clusters that were retained for inspection, which
+	// are otherwise only deleted once they are older than TTL
+	DeleteRetained bool
+	DryRun         bool
+
+	Logger klog.Logger
+}
+
+type OrphanedCluster struct {
+	Name     string
+	Metadata *ClusterMetadata
+	Reason   string
+}
+
+// ListClusters returns names of all clusters that have ClusterNamePrefix
+func ListClusters(logger klog.Logger) ([]string, error) {
+	clusters, err := newKindProvider(logger).List()
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(clusters, func(name string) bool {
+		return !strings.HasPrefix(name, ClusterNamePrefix)
+	}), nil
+}
+
+// FindOrphaned returns clusters whose owner process has exited, or which are older than
+// opts.TTL; shared clusters are considered owned as long as anyone holds a lease on them
+func FindOrphaned(opts GCOptions) ([]OrphanedCluster, error) {
+	clusters, err := ListClusters(opts.Logger)
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	now := time.Now()
+
+	orphaned := []OrphanedCluster{}
+	for _, name := range clusters {
+		md, err := ReadMetadata(name)
+		if err != nil {
+			return nil, err
+		}
+		if reason := orphanedReason(md, opts, hostname, now); reason != "" {
+			orphaned = append(orphaned, OrphanedCluster{Name: name, Metadata: md, Reason: reason})
+		}
+	}
+	return orphaned, nil
+}
+
+func orphanedReason(md *ClusterMetadata, opts GCOptions, hostname string, now time.Time) string {
+	switch {
+	case md == nil:
+		if opts.DeleteUntracked {
+			return "no metadata recorded"
+		}
+		return ""
+	case opts.TTL > 0 && now.Sub(md.Created) > opts.TTL:
+		return fmt.Sprintf("older than %s", opts.TTL)
+	case md.Retained:
+		if opts.DeleteRetained {
+			return "retained"
+		}
+		return ""
+	case md.ReuseUntil != nil:
+		// kept for reuse after the owner has exited, the owner is the last process that
+		// reused the cluster, which may still be using it after the TTL has lapsed
+		if now.After(*md.ReuseUntil) && (md.Hostname != hostname || !processAlive(md.PID)) {
+			return "reuse TTL has lapsed"
+		}
+		return ""
+	case md.StateFile != "":
+		state, err := readSharedState(md.StateFile)
+		if err != nil || state == nil || ClusterNamePrefix+state.UUID.String() != md.Name {
+			return "not recorded in shared state file"
+		}
+		if slices.ContainsFunc(state.Leases, func(l lease) bool { return l.valid(hostname, now) }) {
+			return ""
+		}
+		return "no valid leases in shared state file"
+	case md.Hostname == hostname && !processAlive(md.PID):
+		return fmt.Sprintf("owner process %d has exited", md.PID)
+	default:
+		return ""
+	}
+}
+
+// GC deletes orphaned clusters, see FindOrphaned
+func GC(opts GCOptions) ([]OrphanedCluster, error) {
+	orphaned, err := FindOrphaned(opts)
+	if err != nil {
+		return nil, err
+	}
+	errs := []error{}
+	for _, o := range orphaned {
+		opts.Logger.Info("GC(): deleting orphaned cluster", "kind-cluster-name", o.Name, "reason", o.Reason, "dry-run", opts.DryRun)
+		if opts.DryRun {
+			continue
+		}
+		if err := DeleteCluster(opts.Logger, o.Name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return orphaned, errors.Join(errs...)
+}
+
+func newKindProvider(logger klog.Logger) *cluster.Provider {
+	return cluster.NewProvider(cluster.ProviderWithLogger(&log.Adapter{Logger: logger.WithName("kind")}))
+}
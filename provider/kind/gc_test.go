@@ -0,0 +1,28 @@
+package kind
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestKindOrphanedReasonReuse(t *testing.T) {
+	g := NewWithT(t)
+
+	hostname, _ := os.Hostname()
+	now := time.Now()
+	lapsed := now.Add(-time.Minute)
+
+	md := &ClusterMetadata{Name: "kte-reused", PID: os.Getpid(), Hostname: hostname, ReuseUntil: &lapsed}
+	// the owner is still running
+	g.Expect(orphanedReason(md, GCOptions{}, hostname, now)).To(BeEmpty())
+
+	md.Hostname = "elsewhere"
+	g.Expect(orphanedReason(md, GCOptions{}, hostname, now)).To(Equal("reuse TTL has lapsed"))
+
+	valid := now.Add(time.Minute)
+	md.ReuseUntil = &valid
+	g.Expect(orphanedReason(md, GCOptions{}, hostname, now)).To(BeEmpty())
+}
@@ -0,0 +1,236 @@
+package kind
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+	"sigs.k8s.io/kind/pkg/cluster/nodeutils"
+
+	"github.com/errordeveloper/kube-test-env/provider"
+)
+
+type ImageLoadResult struct {
+	Node string
+	// Loaded and Skipped are image references, images are skipped when
+	// the node already has them with the same ID
+	Loaded  []string
+	Skipped []string
+	Err     error
+}
+
+// image is a reference and the ID (i.e. digest of config) that it resolves to
+type image struct {
+	ref, id string
+}
+
+// LoadImages loads images from the host Docker daemon into every node
+func (k *Managed) LoadImages(ctx context.Context, refs ...string) ([]ImageLoadResult, error) {
+	return k.LoadImagesOnNodes(ctx, nil, refs...)
+}
+
+// LoadImagesOnNodes is like LoadImages, but only loads into nodes with the given names
+func (k *Managed) LoadImagesOnNodes(ctx context.Context, nodeNames []string, refs ...string) ([]ImageLoadResult, error) {
+	var results []ImageLoadResult
+	err := provider.RunContext(ctx, "LoadImages", k.ClusterName(), func(ctx context.Context) error {
+		refs = slices.Clone(refs)
+		slices.Sort(refs)
+		refs = slices.Compact(refs)
+
+		images := []image{}
+		for _, ref := range refs {
+			id, err := hostImageID(ctx, ref)
+			if err != nil {
+				return fmt.Errorf("image %q is not present on the host: %w", ref, err)
+			}
+			images = append(images, image{ref: ref, id: id})
+		}
+		archive, err := os.CreateTemp("", "kte-images-*.tar")
+		if err != nil {
+			return err
+		}
+		_ = archive.Close()
+		defer os.Remove(archive.Name())
+
+		var saved bool
+		results, err = k.loadImages(nodeNames, images, func() (string, error) {
+			if !saved {
+				args := append([]string{"save", "-o", archive.Name()}, refs...)
+				if out, err := exec.CommandContext(ctx, "docker", args...).CombinedOutput(); err != nil {
+					return "", fmt.Errorf("docker save failed: %w: %s", err, out)
+				}
+				saved = true
+			}
+			return archive.Name(), nil
+		})
+		return err
+	}, nil)
+	if provider.IsStillRunning(err) {
+		return nil, err
+	}
+	return results, err
+}
+
+// LoadImageArchive loads images from an archive created by 'docker save' into every node
+func (k *Managed) LoadImageArchive(ctx context.Context, archivePath string) ([]ImageLoadResult, error) {
+	return k.LoadImageArchiveOnNodes(ctx, nil, archivePath)
+}
+
+// LoadImageArchiveOnNodes is like LoadImageArchive, but only loads into nodes with the given names
+func (k *Managed) LoadImageArchiveOnNodes(ctx context.Context, nodeNames []string, archivePath string) ([]ImageLoadResult, error) {
+	var results []ImageLoadResult
+	err := provider.RunContext(ctx, "LoadImageArchive", k.ClusterName(), func(context.Context) error {
+		images, err := archiveImages(archivePath)
+		if err != nil {
+			return err
+		}
+		results, err = k.loadImages(nodeNames, images, func() (string, error) { return archivePath, nil })
+		return err
+	}, nil)
+	if provider.IsStillRunning(err) {
+		return nil, err
+	}
+	return results, err
+}
+
+// loadImages imports the archive into nodes that are missing any of the images, the archive
+// is only obtained if there is at least one such node
+func (k *Managed) loadImages(nodeNames []string, images []image, archive func() (string, error)) ([]ImageLoadResult, error) {
+	selected, err := k.selectNodes(nodeNames)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ImageLoadResult, len(selected))
+	pending := []int{}
+	for i, node := range selected {
+		results[i].Node = node.String()
+		for _, image := range images {
+			if id, err := nodeutils.ImageID(node, image.ref); err == nil && id == image.id {
+				results[i].Skipped = append(results[i].Skipped, image.ref)
+			} else {
+				results[i].Loaded = append(results[i].Loaded, image.ref)
+			}
+		}
+		if len(results[i].Loaded) > 0 {
+			pending = append(pending, i)
+		}
+	}
+	if len(pending) == 0 {
+		k.Logger.Info("LoadImages(): all images are already present", "kind-cluster-name", k.ClusterName())
+		return results, nil
+	}
+
+	archivePath, err := archive()
+	if err != nil {
+		return nil, err
+	}
+
+	wg := sync.WaitGroup{}
+	for _, i := range pending {
+		wg.Add(1)
+		go func(result *ImageLoadResult, node nodes.Node) {
+			defer wg.Done()
+			k.Logger.Info("LoadImages(): loading images", "kind-cluster-name", k.ClusterName(), "node", result.Node, "images", result.Loaded)
+			f, err := os.Open(archivePath)
+			if err != nil {
+				result.Err = err
+				return
+			}
+			defer f.Close()
+			if err := nodeutils.LoadImageArchive(node, f); err != nil {
+				result.Err = fmt.Errorf("node %q: %w", result.Node, err)
+			}
+		}(&results[i], selected[i])
+	}
+	wg.Wait()
+
+	errs := []error{}
+	for _, result := range results {
+		errs = append(errs, result.Err)
+	}
+	return results, errors.Join(errs...)
+}
+
+func (k *Managed) selectNodes(nodeNames []string) ([]nodes.Node, error) {
+	all, err := k.Provider.ListInternalNodes(k.ClusterName())
+	if err != nil {
+		return nil, err
+	}
+	if len(all) == 0 {
+		return nil, fmt.Errorf("no nodes found for cluster %q", k.ClusterName())
+	}
+	if len(nodeNames) == 0 {
+		return all, nil
+	}
+	selected := []nodes.Node{}
+	for _, name := range nodeNames {
+		i := slices.IndexFunc(all, func(node nodes.Node) bool { return node.String() == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown node %q in cluster %q", name, k.ClusterName())
+		}
+		selected = append(selected, all[i])
+	}
+	return selected, nil
+}
+
+func hostImageID(ctx context.Context, ref string) (string, error) {
+	out, err := exec.CommandContext(ctx, "docker", "image", "inspect", "-f", "{{ .Id }}", ref).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// archiveImages reads manifest.json of a 'docker save' archive, image IDs are taken from
+// names of config blobs, which are either '<hex>.json' or 'blobs/sha256/<hex>'
+func archiveImages(archivePath string) ([]image, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := tar.NewReader(f)
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("archive %q has no manifest.json", archivePath)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read archive %q: %w", archivePath, err)
+		}
+		if path.Clean(header.Name) != "manifest.json" {
+			continue
+		}
+		manifest := []struct {
+			Config   string
+			RepoTags []string
+		}{}
+		if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+			return nil, fmt.Errorf("cannot parse manifest.json in archive %q: %w", archivePath, err)
+		}
+		images := []image{}
+		for _, entry := range manifest {
+			id := "sha256:" + strings.TrimSuffix(filepath.Base(entry.Config), ".json")
+			if len(entry.RepoTags) == 0 {
+				images = append(images, image{ref: id, id: id})
+			}
+			for _, ref := range entry.RepoTags {
+				images = append(images, image{ref: ref, id: id})
+			}
+		}
+		return images, nil
+	}
+}
@@ -0,0 +1,256 @@
+package kind
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// EnvMergeKubeConfig enables MergeKubeConfig for all managed clusters
+const EnvMergeKubeConfig = "KTE_MERGE_KUBECONFIG"
+
+// ExtraContext is a context that uses credentials of the cluster admin to impersonate
+// a user and/or selects a namespace
+type ExtraContext struct {
+	// Name is prefixed with the name of the default context, e.g. 'kind-kte-<uuid>-<name>'
+	Name      string
+	Namespace string
+	User      string
+	Groups    []string
+}
+
+// KubeContext returns the name of the default context, which is also the name of the
+// cluster and the user in the kubeconfig
+func (k *Managed) KubeContext() string {
+	return "kind-" + k.ClusterName()
+}
+
+func (k *Managed) extraContextName(extra ExtraContext) string {
+	return k.KubeContext() + "-" + extra.Name
+}
+
+// UserKubeConfigPath returns the kubeconfig that kubectl uses by default, i.e. the
+// first path in $KUBECONFIG or ~/.kube/config
+func UserKubeConfigPath() string {
+	return clientcmd.NewDefaultPathOptions().GetDefaultFilename()
+}
+
+func mergeKubeConfigFromEnv() bool {
+	value := os.Getenv(EnvMergeKubeConfig)
+	return value != "" && value != "false"
+}
+
+// kubeConfig loads the kubeconfig written by kind and adds the extra contexts
+func (k *Managed) kubeConfig(extra ...ExtraContext) (*clientcmdapi.Config, error) {
+	config, err := clientcmd.LoadFromFile(k.KubeConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	return k.withExtraContexts(config, extra...)
+}
+
+func (k *Managed) withExtraContexts(config *clientcmdapi.Config, extra ...ExtraContext) (*clientcmdapi.Config, error) {
+	authInfo, ok := config.AuthInfos[k.KubeContext()]
+	if !ok {
+		return nil, fmt.Errorf("user %q not found in kubeconfig of cluster %q", k.KubeContext(), k.ClusterName())
+	}
+	for _, extra := range append(slices.Clone(k.ExtraContexts), extra...) {
+		if extra.Name == "" {
+			return nil, fmt.Errorf("extra context of cluster %q has no name", k.ClusterName())
+		}
+		name := k.extraContextName(extra)
+		extraAuthInfo := authInfo.DeepCopy()
+		extraAuthInfo.Impersonate = extra.User
+		extraAuthInfo.ImpersonateGroups = extra.Groups
+		config.AuthInfos[name] = extraAuthInfo
+		config.Contexts[name] = &clientcmdapi.Context{
+			Cluster:   k.KubeContext(),
+			AuthInfo:  name,
+			Namespace: extra.Namespace,
+		}
+	}
+	return config, nil
+}
+
+// WriteKubeConfig writes a kubeconfig with the default context, ExtraContexts and
+// the given extra contexts to path
+func (k *Managed) WriteKubeConfig(path string, extra ...ExtraContext) error {
+	config, err := k.kubeConfig(extra...)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return clientcmd.WriteToFile(*config, path)
+}
+
+// ProcessKubeConfigPath is where Create writes the kubeconfig with ExtraContexts, it's
+// per process, as the kubeconfig of a shared cluster belongs to the process that created it
+func (k *Managed) ProcessKubeConfigPath() string {
+	return filepath.Join(k.ArtifactDir, k.ClusterName(), fmt.Sprintf("kubeconfig-%d", os.Getpid()))
+}
+
+// setupKubeConfig writes the kubeconfig with ExtraContexts once the cluster is created,
+// and merges it into the user's kubeconfig if MergeKubeConfig is set
+func (k *Managed) setupKubeConfig() error {
+	if len(k.ExtraContexts) > 0 {
+		if err := k.WriteKubeConfig(k.ProcessKubeConfigPath()); err != nil {
+			return err
+		}
+	}
+	if k.MergeKubeConfig {
+		return k.mergeKubeConfig()
+	}
+	return nil
+}
+
+// cleanupKubeConfig undoes setupKubeConfig
+func (k *Managed) cleanupKubeConfig() error {
+	errs := []error{}
+	if len(k.ExtraContexts) > 0 {
+		if err := os.Remove(k.ProcessKubeConfigPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	if k.MergeKubeConfig {
+		errs = append(errs, k.unmergeKubeConfig())
+	}
+	return errors.Join(errs...)
+}
+
+// modifyUserKubeConfig applies fn to the user's kubeconfig, clientcmd only locks the file
+// while writing it, so the whole read-modify-write is done under a lock of its own
+func modifyUserKubeConfig(fn func(*clientcmdapi.Config)) error {
+	pathOptions := clientcmd.NewDefaultPathOptions()
+	if fileLockingSupported {
+		path := pathOptions.GetDefaultFilename()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		unlock, err := lockFile(ctx, path+".kte-lock")
+		if err != nil {
+			return fmt.Errorf("cannot lock kubeconfig %q: %w", path, err)
+		}
+		defer unlock()
+	}
+	userConfig, err := pathOptions.GetStartingConfig()
+	if err != nil {
+		return err
+	}
+	fn(userConfig)
+	return clientcmd.ModifyConfig(pathOptions, *userConfig, false)
+}
+
+// mergeKubeConfig adds clusters, users and contexts to the user's kubeconfig, the
+// current context is only set if there was none
+func (k *Managed) mergeKubeConfig() error {
+	config, err := k.kubeConfig()
+	if err != nil {
+		return err
+	}
+	k.Logger.Info("Create(): merging kubeconfig", "kind-cluster-name", k.ClusterName(),
+		"kubeconfig", UserKubeConfigPath(), "context", k.KubeContext())
+	return modifyUserKubeConfig(func(userConfig *clientcmdapi.Config) {
+		for name, cluster := range config.Clusters {
+			userConfig.Clusters[name] = cluster
+		}
+		for name, authInfo := range config.AuthInfos {
+			userConfig.AuthInfos[name] = authInfo
+		}
+		for name, context := range config.Contexts {
+			userConfig.Contexts[name] = context
+		}
+		if userConfig.CurrentContext == "" {
+			userConfig.CurrentContext = k.KubeContext()
+		}
+	})
+}
+
+// unmergeKubeConfig removes everything that mergeKubeConfig added to the user's
+// kubeconfig, including the current context if it was one of the cluster's
+func (k *Managed) unmergeKubeConfig() error {
+	names := []string{k.KubeContext()}
+	for _, extra := range k.ExtraContexts {
+		names = append(names, k.extraContextName(extra))
+	}
+	k.Logger.Info("Delete(): unmerging kubeconfig", "kind-cluster-name", k.ClusterName(),
+		"kubeconfig", UserKubeConfigPath())
+	return modifyUserKubeConfig(func(userConfig *clientcmdapi.Config) {
+		for _, name := range names {
+			delete(userConfig.Clusters, name)
+			delete(userConfig.AuthInfos, name)
+			delete(userConfig.Contexts, name)
+			if userConfig.CurrentContext == name {
+				userConfig.CurrentContext = ""
+			}
+		}
+	})
+}
+
+// InternalKubeConfig returns a kubeconfig that uses the address of the control-plane
+// on the Docker network, rather than the port published on the host; it's meant for
+// tools running in containers attached to DockerNetwork
+func (k *Managed) InternalKubeConfig() ([]byte, error) {
+	data, err := k.Provider.KubeConfig(k.ClusterName(), true)
+	if err != nil {
+		return nil, err
+	}
+	config, err := clientcmd.Load([]byte(data))
+	if err != nil {
+		return nil, err
+	}
+	if config, err = k.withExtraContexts(config); err != nil {
+		return nil, err
+	}
+	return clientcmd.Write(*config)
+}
+
+func (k *Managed) NewInternalClientConfig() (*rest.Config, error) {
+	data, err := k.InternalKubeConfig()
+	if err != nil {
+		return nil, err
+	}
+	config, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, err
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: k.KubeContext()}
+	return clientcmd.NewDefaultClientConfig(*config, overrides).ClientConfig()
+}
+
+func (k *Managed) InternalKubeConfigPath() string {
+	return filepath.Join(k.ArtifactDir, k.ClusterName(), "kubeconfig-internal")
+}
+
+// WriteInternalKubeConfig writes InternalKubeConfig to the artifact directory, so that
+// it can be mounted into other containers; it holds admin credentials, so it's only
+// readable by the current user, and containers that mount it need to run as the same UID
+func (k *Managed) WriteInternalKubeConfig() (string, error) {
+	data, err := k.InternalKubeConfig()
+	if err != nil {
+		return "", err
+	}
+	path := k.InternalKubeConfigPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", err
+	}
+	// the mode is not changed if the file already existed
+	if err := os.Chmod(path, 0o600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,202 @@
+package kind
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+	"sigs.k8s.io/kind/pkg/cluster/nodeutils"
+)
+
+const (
+	DefaultLocalRegistryImage = "registry:2"
+
+	localRegistryPort          = 5000
+	localRegistryHostingName   = "local-registry-hosting"
+	localRegistryHostingNS     = "kube-public"
+	localRegistryContainerdDir = "/etc/containerd/certs.d"
+	localRegistryLabel         = "io.github.errordeveloper.kube-test-env.cluster"
+)
+
+// LocalRegistry is a registry container that is started on the same Docker network as
+// the nodes, see https://kind.sigs.k8s.io/docs/user/local-registry/
+type LocalRegistry struct {
+	Image string `json:"image,omitempty"`
+	// HostPort is where the registry is published on the host, a free port is picked if it's 0
+	HostPort int `json:"hostPort,omitempty"`
+}
+
+func (k *Managed) localRegistryContainerName() string {
+	return localRegistryContainerName(k.ClusterName())
+}
+
+func localRegistryContainerName(clusterName string) string { return clusterName + "-registry" }
+
+// LocalRegistryHostAddress returns the address for pushing images from the host, which is
+// also the address pods should use to pull images, it's empty if there is no registry
+func (k *Managed) LocalRegistryHostAddress() string {
+	if k.LocalRegistry == nil {
+		return ""
+	}
+	if k.LocalRegistry.HostPort == 0 {
+		// the cluster was created by another process
+		out, err := exec.Command("docker", "port", k.localRegistryContainerName(), strconv.Itoa(localRegistryPort)).Output()
+		if err != nil {
+			return ""
+		}
+		_, port, err := net.SplitHostPort(strings.TrimSpace(strings.Split(string(out), "\n")[0]))
+		if err != nil {
+			return ""
+		}
+		k.LocalRegistry.HostPort, _ = strconv.Atoi(port)
+	}
+	return net.JoinHostPort("localhost", strconv.Itoa(k.LocalRegistry.HostPort))
+}
+
+// LocalRegistryClusterAddress returns the address of the registry on the Docker network,
+// which can be used by the nodes and by pods that use host network
+func (k *Managed) LocalRegistryClusterAddress() string {
+	if k.LocalRegistry == nil {
+		return ""
+	}
+	return net.JoinHostPort(k.localRegistryContainerName(), strconv.Itoa(localRegistryPort))
+}
+
+func (k *Managed) withLocalRegistryConfig(config *Cluster) *Cluster {
+	if k.LocalRegistry == nil {
+		return config
+	}
+	if config == nil {
+		config = &Cluster{}
+	} else {
+		config = config.DeepCopy()
+	}
+	config.ContainerdConfigPatches = append(config.ContainerdConfigPatches,
+		"[plugins.\"io.containerd.grpc.v1.cri\".registry]\n  config_path = \""+localRegistryContainerdDir+"\"\n")
+	return config
+}
+
+// DockerNetwork returns the network that kind creates nodes in, containers that
+// use InternalKubeConfig need to be attached to it
+func DockerNetwork() string {
+	if network := os.Getenv("KIND_EXPERIMENTAL_DOCKER_NETWORK"); network != "" {
+		return network
+	}
+	return "kind"
+}
+
+// localRegistryNetwork is a variable, so that tests can make connecting the registry fail
+var localRegistryNetwork = DockerNetwork
+
+func (k *Managed) configureLocalRegistry(node nodes.Node) error {
+	hostsFile := fmt.Sprintf("%s/%s/hosts.toml", localRegistryContainerdDir, k.LocalRegistryHostAddress())
+	hostsConfig := fmt.Sprintf("[host.\"http://%s\"]\n", k.LocalRegistryClusterAddress())
+	if err := nodeutils.WriteFile(node, hostsFile, hostsConfig); err != nil {
+		return fmt.Errorf("failed to configure local registry on node %q: %w", node.String(), err)
+	}
+	return nil
+}
+
+func (k *Managed) startLocalRegistry() error {
+	if k.LocalRegistry.Image == "" {
+		k.LocalRegistry.Image = DefaultLocalRegistryImage
+	}
+	if k.LocalRegistry.HostPort == 0 {
+		port, err := freePort()
+		if err != nil {
+			return err
+		}
+		k.LocalRegistry.HostPort = port
+	}
+	k.Logger.Info("Create(): starting local registry", "kind-cluster-name", k.ClusterName(),
+		"container", k.localRegistryContainerName(), "address", k.LocalRegistryHostAddress())
+	out, err := exec.Command("docker", "run", "--detach", "--restart=always",
+		"--name", k.localRegistryContainerName(),
+		"--label", localRegistryLabel+"="+k.ClusterName(),
+		"--publish", fmt.Sprintf("127.0.0.1:%d:%d", k.LocalRegistry.HostPort, localRegistryPort),
+		k.LocalRegistry.Image).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to start local registry: %w: %s", err, out)
+	}
+	k.localRegistryStarted = true
+	return nil
+}
+
+// connectLocalRegistry makes the registry reachable from the nodes, this can only be done
+// once the cluster is created, as that's when the network gets created
+func (k *Managed) connectLocalRegistry(ctx context.Context) error {
+	network := localRegistryNetwork()
+	out, err := exec.CommandContext(ctx, "docker", "network", "connect", network, k.localRegistryContainerName()).CombinedOutput()
+	if err != nil && !strings.Contains(string(out), "already exists") {
+		return fmt.Errorf("failed to connect local registry to network %q: %w: %s", network, err, out)
+	}
+
+	nodes, err := k.Provider.ListInternalNodes(k.ClusterName())
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if err := k.configureLocalRegistry(node); err != nil {
+			return err
+		}
+	}
+
+	clientMaker, err := k.NewClientMaker()
+	if err != nil {
+		return err
+	}
+	clientSet, err := clientMaker.NewClientSet()
+	if err != nil {
+		return err
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      localRegistryHostingName,
+			Namespace: localRegistryHostingNS,
+		},
+		Data: map[string]string{
+			"localRegistryHosting.v1": fmt.Sprintf("host: %q\nhostFromClusterNetwork: %q\nhostFromContainerRuntime: %q\nhelp: %q\n",
+				k.LocalRegistryHostAddress(), k.LocalRegistryClusterAddress(), k.LocalRegistryHostAddress(),
+				"https://kind.sigs.k8s.io/docs/user/local-registry/"),
+		},
+	}
+	_, err = clientSet.CoreV1().ConfigMaps(localRegistryHostingNS).Create(ctx, configMap, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = clientSet.CoreV1().ConfigMaps(localRegistryHostingNS).Update(ctx, configMap, metav1.UpdateOptions{})
+	}
+	return err
+}
+
+func (k *Managed) removeLocalRegistry() error {
+	if k.LocalRegistry == nil {
+		return nil
+	}
+	k.Logger.Info("Delete(): removing local registry", "kind-cluster-name", k.ClusterName(), "container", k.localRegistryContainerName())
+	return removeLocalRegistryContainer(k.ClusterName())
+}
+
+func removeLocalRegistryContainer(clusterName string) error {
+	out, err := exec.Command("docker", "rm", "--force", "--volumes", localRegistryContainerName(clusterName)).CombinedOutput()
+	if err != nil && !strings.Contains(string(out), "No such container") {
+		return fmt.Errorf("failed to remove local registry: %w: %s", err, out)
+	}
+	return nil
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
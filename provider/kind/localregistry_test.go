@@ -0,0 +1,38 @@
+package kind
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	klog "k8s.io/klog/v2"
+)
+
+func TestKindLocalRegistryConnectFailure(t *testing.T) {
+	g := NewWithT(t)
+
+	log := klog.FromContext(context.Background())
+
+	stateDir := StateDir
+	StateDir = t.TempDir()
+	defer func() { StateDir = stateDir }()
+
+	network := localRegistryNetwork
+	localRegistryNetwork = func() string { return "kte-no-such-network" }
+	defer func() { localRegistryNetwork = network }()
+
+	k := New(t.TempDir(), log).(*Managed)
+	k.LocalRegistry = &LocalRegistry{}
+
+	g.Expect(k.Create(nil, time.Minute*10)).To(MatchError(ContainSubstring("failed to connect local registry")))
+
+	clusters, err := k.Provider.List()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(clusters).NotTo(ContainElement(k.ClusterName()))
+
+	g.Expect(exec.Command("docker", "inspect", k.localRegistryContainerName()).Run()).NotTo(Succeed())
+	g.Expect(ReadMetadata(k.ClusterName())).Error().To(HaveOccurred())
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package kind
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+)
+
+const fileLockingSupported = false
+
+func lockFile(_ context.Context, _ string) (func(), error) {
+	return nil, fmt.Errorf("file locking is not supported on %s", runtime.GOOS)
+}
+
+// processAlive cannot tell on this platform, so leases only expire by TTL
+func processAlive(_ int) bool { return true }
@@ -0,0 +1,156 @@
+package kind
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"testing"
+	"time"
+
+	klog "k8s.io/klog/v2"
+
+	"github.com/errordeveloper/kube-test-env/addons"
+	"github.com/errordeveloper/kube-test-env/provider"
+)
+
+const EnvArtifactDir = "KTE_ARTIFACT_DIR"
+
+type MainOptions struct {
+	// Config defaults to SharedConfig
+	Config *Cluster
+	Addons addons.Config
+
+	// ArtifactDir is where kubeconfig and logs are stored, it defaults to
+	// KTE_ARTIFACT_DIR or 'kte-artifacts' in the system temp directory
+	ArtifactDir string
+	// Retain defaults to RetainNever, it's overridden by EnvRetain
+	Retain RetainPolicy
+
+	// Timeout defaults to SharedTimeout
+	Timeout time.Duration
+	// Logger defaults to Log
+	Logger klog.Logger
+}
+
+// Main creates the shared cluster, applies addons, runs the tests, collects logs
+// if any of the tests failed and deletes the cluster; values set in the config
+// file take precedence over opts; it returns the exit code
+// to be passed to os.Exit, e.g.:
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(kind.Main(m, kind.MainOptions{}))
+//	}
+func Main(m *testing.M, opts MainOptions) int {
+	logger := opts.Logger
+	if logger.GetSink() == nil {
+		logger = Log
+	}
+	fileConfig, err := ConfigFromEnv()
+	if err != nil {
+		logger.Error(err, "failed to load config")
+		return 1
+	}
+	setInCode := []string{}
+	if opts.Addons != (addons.Config{}) {
+		setInCode = append(setInCode, "addons")
+	}
+	if opts.Retain != "" && os.Getenv(EnvRetain) == "" {
+		setInCode = append(setInCode, "retain")
+	}
+	fileConfig.logOverrides(logger, setInCode...)
+	if fileConfig.Addons != nil {
+		opts.Addons = *fileConfig.Addons
+	}
+	retain, err := retainPolicyFromEnv(fileConfig, opts.Retain)
+	if err != nil {
+		logger.Error(err, "failed to determine retain policy")
+		return 1
+	}
+
+	if opts.Config == nil {
+		opts.Config = SharedConfig
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = SharedTimeout
+	}
+	if opts.ArtifactDir == "" {
+		opts.ArtifactDir = defaultArtifactDir()
+	}
+	if err := os.MkdirAll(opts.ArtifactDir, 0o755); err != nil {
+		logger.Error(err, "failed to create artifact directory", "artifact-dir", opts.ArtifactDir)
+		return 1
+	}
+
+	k, code := setupShared(logger, opts)
+	if code != 0 {
+		return code
+	}
+
+	code = m.Run()
+
+	if code != 0 {
+		if err := SharedCollectLogs(); err != nil {
+			logger.Error(err, "failed to collect logs")
+		} else if dir := SharedLogsDir(); dir != "" {
+			logger.Info("tests failed, collected logs", "logs-dir", dir)
+		}
+	}
+	if retain.retain(code != 0) {
+		if _, err := retainIfManaged(k); err != nil {
+			logger.Error(err, "failed to retain shared cluster")
+		} else {
+			return code
+		}
+	}
+
+	if err := SharedDelete(); err != nil {
+		logger.Error(err, "failed to delete shared cluster")
+		if code == 0 {
+			code = 1
+		}
+	}
+	return code
+}
+
+func defaultArtifactDir() string {
+	if dir := os.Getenv(EnvArtifactDir); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "kte-artifacts")
+}
+
+func setupShared(logger klog.Logger, opts MainOptions) (provider.Provider, int) {
+	// interrupting the setup should not leave a half-created cluster behind
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	k, err := provider.SharedContext(ctx, Name, provider.Options{
+		ArtifactDir: opts.ArtifactDir,
+		Logger:      logger,
+		Config:      opts.Config,
+		Timeout:     opts.Timeout,
+	})
+	if err != nil {
+		logger.Error(err, "failed to create shared cluster")
+		return nil, 1
+	}
+
+	if opts.Addons != (addons.Config{}) {
+		if err := k.ApplyAddons(ctx, opts.Addons); err != nil {
+			logger.Error(err, "failed to apply addons to shared cluster", "kind-cluster-name", k.ClusterName())
+			if err := SharedCollectLogs(); err != nil {
+				logger.Error(err, "failed to collect logs")
+			}
+			if err := SharedDelete(); err != nil {
+				logger.Error(err, "failed to delete shared cluster")
+			}
+			return nil, 1
+		}
+	}
+	// addons are part of the baseline, so that SharedReset keeps them
+	if err := SharedRecordBaseline(ctx); err != nil {
+		logger.Error(err, "failed to record baseline of shared cluster", "kind-cluster-name", k.ClusterName())
+	}
+	return k, 0
+}
@@ -0,0 +1,47 @@
+package kind
+
+import (
+	"testing"
+)
+
+// MatrixParallelism limits how many clusters RunMatrix creates at the same time,
+// in addition to the limit set by 'go test -parallel'
+var MatrixParallelism = 2
+
+// RunMatrix runs fn as a parallel subtest for each of the Kubernetes versions, against
+// a cluster created like ForTest does with the node image from NodeImageCatalog; all of
+// SupportedVersions are used if versions is empty
+func RunMatrix(t *testing.T, versions []string, fn func(t *testing.T, k KindLifecycle)) {
+	t.Helper()
+
+	if len(versions) == 0 {
+		var err error
+		versions, err = SupportedVersions()
+		if err != nil {
+			t.Fatalf("failed to list supported versions: %v", err)
+		}
+	}
+
+	images := make([]string, len(versions))
+	for i, version := range versions {
+		image, err := NodeImageFor(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		images[i] = image
+	}
+
+	slots := make(chan struct{}, max(MatrixParallelism, 1))
+	for i, version := range versions {
+		image := images[i]
+		t.Run("v"+minorVersion(version), func(t *testing.T) {
+			t.Parallel()
+
+			slots <- struct{}{}
+			// registered first, so that it runs after the cluster is deleted
+			t.Cleanup(func() { <-slots })
+
+			fn(t, forTest(t, nil, image))
+		})
+	}
+}
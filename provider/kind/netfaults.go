@@ -0,0 +1,128 @@
+package kind
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+)
+
+const (
+	// faultsChain is the iptables chain that holds partition rules, it's hooked into
+	// INPUT and OUTPUT, so that Heal only needs to flush it
+	faultsChain = "KTE-FAULTS"
+
+	nodeInterface = "eth0"
+)
+
+// Partition drops all traffic between the two nodes in both directions, it can be
+// called multiple times to isolate a node from several others
+func (k *Managed) Partition(ctx context.Context, nodeA, nodeB string) error {
+	a, err := k.node(nodeA)
+	if err != nil {
+		return err
+	}
+	b, err := k.node(nodeB)
+	if err != nil {
+		return err
+	}
+	errA := dropTraffic(ctx, a, b)
+	errB := dropTraffic(ctx, b, a)
+	// rules may have been added on one of the nodes even if the other one failed
+	if errA == nil || errB == nil {
+		k.faulted = true
+	}
+	err = errors.Join(errA, errB)
+	if err != nil {
+		err = fmt.Errorf("failed to partition nodes %q and %q: %w", nodeA, nodeB, err)
+	}
+	k.recordFault("partition", nodeA+"<->"+nodeB, err)
+	return err
+}
+
+// AddLatency delays all packets sent by the node, it replaces latency that was
+// added before; requires the netem kernel module on the host
+func (k *Managed) AddLatency(ctx context.Context, name string, delay time.Duration) error {
+	node, err := k.node(name)
+	if err != nil {
+		return err
+	}
+	cmd := node.CommandContext(ctx, "tc", "qdisc", "replace", "dev", nodeInterface, "root",
+		"netem", "delay", fmt.Sprintf("%dus", delay.Microseconds()))
+	if err = cmd.Run(); err != nil {
+		err = fmt.Errorf("failed to add latency to node %q: %w", name, err)
+	} else {
+		k.faulted = true
+	}
+	k.recordFault("latency="+delay.String(), name, err)
+	return err
+}
+
+// Heal removes all partitions and latency from all nodes, it's called by Delete; nodes
+// that are not running are skipped, as rules are lost when a stopped node is started
+// again, while a paused node keeps them until it's unpaused and Heal is called again
+func (k *Managed) Heal(ctx context.Context) error {
+	all, err := k.Provider.ListInternalNodes(k.ClusterName())
+	if err != nil {
+		return err
+	}
+	errs := []error{}
+	paused := false
+	for _, node := range all {
+		status, err := nodeStatus(ctx, node.String())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to heal node %q: %w", node.String(), err))
+			continue
+		}
+		if status != "running" {
+			k.Logger.Info("Heal(): skipping node that is not running", "kind-cluster-name", k.ClusterName(), "node", node.String(), "status", status)
+			paused = paused || status == "paused"
+			continue
+		}
+		// rules may not exist, so errors are ignored
+		_ = node.CommandContext(ctx, "tc", "qdisc", "del", "dev", nodeInterface, "root").Run()
+		for _, iptables := range []string{"iptables", "ip6tables"} {
+			_ = node.CommandContext(ctx, iptables, "--flush", faultsChain).Run()
+		}
+	}
+	err = errors.Join(errs...)
+	if err == nil && !paused {
+		k.faulted = false
+	}
+	k.recordFault("heal", "*", err)
+	return err
+}
+
+// nodeStatus returns the status of the node container, e.g. 'running', 'paused' or 'exited'
+func nodeStatus(ctx context.Context, name string) (string, error) {
+	out, err := exec.CommandContext(ctx, "docker", "inspect", "--format", "{{.State.Status}}", name).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// dropTraffic makes node 'from' drop all packets exchanged with node 'to'
+func dropTraffic(ctx context.Context, from, to nodes.Node) error {
+	ipv4, ipv6, err := to.IP()
+	if err != nil {
+		return err
+	}
+	script := &strings.Builder{}
+	for iptables, ip := range map[string]string{"iptables": ipv4, "ip6tables": ipv6} {
+		if ip == "" {
+			continue
+		}
+		fmt.Fprintf(script, "%[1]s --new-chain %[2]s 2>/dev/null || true\n", iptables, faultsChain)
+		for _, chain := range []string{"INPUT", "OUTPUT"} {
+			fmt.Fprintf(script, "%[1]s --check %[2]s --jump %[3]s 2>/dev/null || %[1]s --insert %[2]s --jump %[3]s\n", iptables, chain, faultsChain)
+		}
+		fmt.Fprintf(script, "%[1]s --append %[2]s --source %[3]s --jump DROP\n", iptables, faultsChain, ip)
+		fmt.Fprintf(script, "%[1]s --append %[2]s --destination %[3]s --jump DROP\n", iptables, faultsChain, ip)
+	}
+	return from.CommandContext(ctx, "sh", "-c", "set -o errexit\n"+script.String()).Run()
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -15,38 +16,35 @@ import (
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	klog "k8s.io/klog/v2"
-	ctrl "sigs.k8s.io/controller-runtime"
 
 	"sigs.k8s.io/kind/pkg/cluster"
 
 	configv1alpha4 "sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
 
-	"github.com/errordeveloper/kube-test-env/addons"
 	"github.com/errordeveloper/kube-test-env/clients"
-	"github.com/errordeveloper/kube-test-env/provider/kind/log"
+	"github.com/errordeveloper/kube-test-env/provider"
 )
 
 const (
 	Name              = "kind"
 	ClusterNamePrefix = "kte-"
 
-	EnvForceIsolated    = "KTE_FORCE_ISOLATED"
-	EnvForceIsolatedAll = "all"
+	EnvForceIsolated    = provider.EnvForceIsolated
+	EnvForceIsolatedAll = provider.EnvForceIsolatedAll
 
 	EnvForcePreexisting       = "KTE_FORCE_PREEXISTING"
 	EnvForcePreexistingAll    = "all"
 	EnvForcePreexistingShared = "shared"
 
 	EnvPreexitstingKubeconfig = "KTE_PREEXISTING_KUBECONFIG"
+	// EnvPreexistingContext selects a context of the pre-existing kubeconfig
+	EnvPreexistingContext = "KTE_PREEXISTING_CONTEXT"
+	// PreexistingInCluster is the value of EnvPreexitstingKubeconfig that selects
+	// in-cluster config, e.g. when tests run in a pod
+	PreexistingInCluster = "in-cluster"
 )
 
-type KindProvider interface {
-	ClusterName() string
-	KubeConfigPath() string
-	NewClientConfig() (*rest.Config, error)
-	NewClientMaker() (*clients.ClientMaker, error)
-	ApplyAddons(context.Context, addons.Config) error
-}
+type KindProvider = provider.Provider
 
 type KindLifecycle interface {
 	KindProvider
@@ -55,10 +53,17 @@ type KindLifecycle interface {
 	CollectLogs() error
 	LogsDir() string
 	Delete() error
+
+	// CreateContext waits for the cluster to become ready until the deadline of ctx,
+	// or for SharedTimeout if there is none; if ctx is done before the cluster is
+	// ready, it gets deleted and provider.CancelledError is returned
+	CreateContext(ctx context.Context, config *Cluster) error
+	CollectLogsContext(ctx context.Context) error
+	DeleteContext(ctx context.Context) error
 }
 
 type Managed struct {
-	Common[KindProvider]
+	provider.Common[KindProvider]
 
 	UUID uuid.UUID
 
@@ -67,26 +72,56 @@ type Managed struct {
 	NodeImage string
 	Retain    bool
 
+	// LocalRegistry is started on Create and removed on Delete when set
+	LocalRegistry        *LocalRegistry
+	localRegistryStarted bool
+
+	// ExtraContexts are added to the kubeconfig on Create
+	ExtraContexts []ExtraContext
+	// MergeKubeConfig merges the kubeconfig into UserKubeConfigPath on Create and
+	// removes it from there on Delete, see EnvMergeKubeConfig
+	MergeKubeConfig bool
+
+	// Reuse makes Delete a no-op, see EnvReuse
+	Reuse           *Reuse
+	configHashValue string
+
+	retained bool
+
+	// faulted is set by Partition and AddLatency, so that Delete heals the nodes
+	faulted bool
+
+	// StateFile makes the cluster shareable across processes, see SharedStateFile
+	StateFile string
+	leaseID   string
+	stopRenew context.CancelFunc
+
 	ArtifactDir string
 	Logger      klog.Logger
 }
 
 type Unmanaged struct {
-	Common[KindProvider]
+	provider.Common[KindProvider]
 
 	Logger klog.Logger
 
 	importedKubeconfigPath string
-}
+	importedKubeconfigData []byte
+	inCluster              bool
+	// context is empty if the current context is used
+	context string
+
+	clusterNameOnce sync.Once
+	clusterName     string
 
-type Common[T KindProvider] struct {
-	k      T
-	logger klog.Logger
+	verifiedLock sync.Mutex
+	verified     bool
 }
 
 type (
 	Cluster    = configv1alpha4.Cluster
 	Node       = configv1alpha4.Node
+	NodeRole   = configv1alpha4.NodeRole
 	Networking = configv1alpha4.Networking
 )
 
@@ -95,93 +130,50 @@ const (
 	WorkerRole       = configv1alpha4.WorkerRole
 )
 
-var shared = struct {
-	once *sync.Once
-	k    KindLifecycle
-}{
-	once: &sync.Once{},
-}
-
 var (
 	SharedConfig  *Cluster
 	SharedTimeout = time.Minute * 10
 )
 
-var Log = klog.NewKlogr()
-
-func init() {
-	ctrl.SetLogger(Log.WithName("kte-controller-runtime"))
-}
+var Log = provider.Log
 
 func Shared(logger klog.Logger) (KindProvider, error) {
-	var initErr error
-	shared.once.Do(func() {
-		logger.Info("initializing shared provider")
-		if preexsting := newUnamanagedFromEnv(logger, false); preexsting != nil {
-			shared.k = preexsting
-			return
-		}
-		artifactDir, err := os.MkdirTemp("", "kte-kind-shared-provider-")
-		if err != nil {
-			initErr = err
-			return
-		}
-		shared.k = New(artifactDir, logger.WithName("kind-shared-provider"))
+	return SharedContext(context.Background(), logger)
+}
 
-		logger.Info("creating cluster with shared provider")
-		if err := shared.k.Create(SharedConfig, SharedTimeout); err != nil {
-			initErr = err
-			return
-		}
+func SharedContext(ctx context.Context, logger klog.Logger) (KindProvider, error) {
+	k, err := provider.SharedContext(ctx, Name, provider.Options{
+		Logger:  logger,
+		Config:  SharedConfig,
+		Timeout: SharedTimeout,
 	})
-	if initErr != nil {
-		return nil, initErr
+	if err != nil {
+		return nil, err
 	}
-
-	if v, ok := os.LookupEnv(EnvForceIsolated); ok && v != EnvForceIsolatedAll {
-		logger.Info("using isolated provider as '" + EnvForceIsolated + "=" + EnvForceIsolatedAll + "' was set")
-		artifactDir, err := os.MkdirTemp("", "kte-kind-shared-provider-")
-		if err != nil {
-			return nil, err
-		}
-		k := New(artifactDir, logger)
-		if err := k.Create(SharedConfig, SharedTimeout); err != nil {
-			return nil, err
-		}
-		return k, nil
+	if l, ok := k.(*lifecycle); ok {
+		return l.KindLifecycle, nil
 	}
+	return k, nil
+}
 
-	logger.Info("using shared provider", "kind-cluster-name", shared.k.ClusterName())
+func SharedCollectLogs() error { return provider.SharedCollectLogs(Name) }
+func SharedLogsDir() string    { return provider.SharedLogsDir(Name) }
+func SharedDelete() error      { return provider.SharedDelete(Name) }
 
-	if shared.k == nil {
-		return nil, fmt.Errorf("shared provider '%s' not initialized", Name)
-	}
-	return shared.k, nil
+func SharedCollectLogsContext(ctx context.Context) error {
+	return provider.SharedCollectLogsContext(ctx, Name)
 }
 
-func SharedCollectLogs() error {
-	if shared.k == nil {
-		return nil
-	}
-	return shared.k.CollectLogs()
+func SharedDeleteContext(ctx context.Context) error {
+	return provider.SharedDeleteContext(ctx, Name)
 }
 
-func SharedLogsDir() string {
-	if shared.k == nil {
-		return ""
-	}
-	return shared.k.LogsDir()
+func SharedRecordBaseline(ctx context.Context) error {
+	return provider.SharedRecordBaseline(ctx, Name)
 }
 
-func SharedDelete() error {
-	if shared.k == nil {
-		return nil
-	}
-	if err := shared.k.Delete(); err != nil {
-		return err
-	}
-	shared.k = nil
-	return nil
+func SharedReset(ctx context.Context) (*clients.ResetReport, error) {
+	return provider.SharedReset(ctx, Name)
 }
 
 func New(artifactDir string, logger klog.Logger) KindLifecycle {
@@ -189,33 +181,64 @@ func New(artifactDir string, logger klog.Logger) KindLifecycle {
 		return preexisting
 	}
 
-	logAdapter := &log.Adapter{logger.WithName("kind")}
 	uuid := uuid.New()
 	k := &Managed{
 		UUID:        uuid,
 		ArtifactDir: artifactDir,
 		Logger:      logger.WithName("kind-provider").WithValues("kind-provider-uuid", uuid.String()),
-		Provider:    cluster.NewProvider(cluster.ProviderWithLogger(logAdapter)),
-	}
-	k.Common = Common[KindProvider]{
-		k:      k,
-		logger: logger,
+		Provider:    newKindProvider(logger),
+		Reuse:       reuseFromEnv(),
+
+		MergeKubeConfig: mergeKubeConfigFromEnv(),
 	}
+	k.Common = provider.NewCommon[KindProvider](k, logger)
 	return k
 }
 
 func NewUnmanaged(logger klog.Logger, importKubeconfigPath string) *Unmanaged {
+	return NewUnmanagedWithContext(logger, importKubeconfigPath, "")
+}
+
+// NewUnmanagedWithContext uses the given context of the kubeconfig rather than
+// the current context
+func NewUnmanagedWithContext(logger klog.Logger, importKubeconfigPath, kubeContext string) *Unmanaged {
 	k := &Unmanaged{
 		Logger:                 logger,
 		importedKubeconfigPath: importKubeconfigPath,
+		context:                kubeContext,
 	}
-	k.Common = Common[KindProvider]{
-		k:      k,
-		logger: logger,
+	k.Common = provider.NewCommon[KindProvider](k, logger)
+	return k
+}
+
+// NewUnmanagedFromBytes uses kubeconfig held in memory, kubeContext can be empty
+func NewUnmanagedFromBytes(logger klog.Logger, kubeconfig []byte, kubeContext string) *Unmanaged {
+	k := &Unmanaged{
+		Logger:                 logger,
+		importedKubeconfigData: kubeconfig,
+		context:                kubeContext,
 	}
+	k.Common = provider.NewCommon[KindProvider](k, logger)
 	return k
 }
 
+// NewUnmanagedInCluster uses service account credentials of the pod it runs in
+func NewUnmanagedInCluster(logger klog.Logger) *Unmanaged {
+	k := &Unmanaged{
+		Logger:    logger,
+		inCluster: true,
+	}
+	k.Common = provider.NewCommon[KindProvider](k, logger)
+	return k
+}
+
+func newUnmanagedFromKubeconfig(logger klog.Logger, kubeconfig string) *Unmanaged {
+	if kubeconfig == PreexistingInCluster {
+		return NewUnmanagedInCluster(logger)
+	}
+	return NewUnmanagedWithContext(logger, kubeconfig, os.Getenv(EnvPreexistingContext))
+}
+
 func newUnamanagedFromEnv(logger klog.Logger, shared bool) *Unmanaged {
 	forcePrexisting, haveForcePrexisting := os.LookupEnv(EnvForcePreexisting)
 	preexistingKubeconfig, havePreexistingKubeconfig := os.LookupEnv(EnvPreexitstingKubeconfig)
@@ -239,13 +262,13 @@ func newUnamanagedFromEnv(logger klog.Logger, shared bool) *Unmanaged {
 	default:
 		switch forcePrexisting {
 		case EnvForcePreexistingAll:
-			return NewUnmanaged(logger.WithName("kind-prexisting-all"), preexistingKubeconfig)
+			return newUnmanagedFromKubeconfig(logger.WithName("kind-prexisting-all"), preexistingKubeconfig)
 		case EnvForcePreexistingShared:
 			if shared {
 				logger.Info("not using pre-exising shared cluster as '" + EnvForcePreexisting + "=" + EnvForcePreexistingShared + "' was set, it needs to be explicitly set to '" + EnvForcePreexistingAll + "'")
 				return nil
 			}
-			return NewUnmanaged(logger.WithName("kind-prexisting-shared"), preexistingKubeconfig)
+			return newUnmanagedFromKubeconfig(logger.WithName("kind-prexisting-shared"), preexistingKubeconfig)
 		default:
 			logger.Info("not using pre-exising cluster as '" + EnvForcePreexisting + "=" + forcePrexisting + "' was set and it's unsupported")
 			return nil
@@ -266,6 +289,56 @@ func (k *Managed) LogsDir() string {
 }
 
 func (k *Managed) Create(config *Cluster, timeout time.Duration) error {
+	// kind doesn't wait for the cluster to be ready when timeout is zero
+	ctxTimeout := timeout
+	if ctxTimeout <= 0 {
+		ctxTimeout = SharedTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ctxTimeout)
+	defer cancel()
+
+	var err error
+	switch {
+	case k.Reuse != nil:
+		err = k.reuseOrCreate(ctx, config, func() error { return k.create(config, timeout) })
+	case k.shared():
+		err = k.attachOrCreate(ctx, func() error { return k.create(config, timeout) })
+	default:
+		err = k.create(config, timeout)
+	}
+	if err != nil {
+		return err
+	}
+	return k.setupCreated(ctx)
+}
+
+// setupCreated connects the local registry if this process started it, sets up kubeconfig
+// and marks the cluster as a test target, if any of it fails the cluster is deleted (or
+// released, if it's shared)
+func (k *Managed) setupCreated(ctx context.Context) error {
+	var err error
+	if k.localRegistryStarted {
+		err = k.connectLocalRegistry(ctx)
+	}
+	if err == nil {
+		err = k.setupKubeConfig()
+	}
+	if err == nil {
+		err = MarkTestTarget(ctx, k)
+	}
+	if err != nil {
+		return errors.Join(err, k.Delete())
+	}
+	return nil
+}
+
+func (k *Managed) create(config *Cluster, timeout time.Duration) error {
+	if k.LocalRegistry != nil {
+		if err := k.startLocalRegistry(); err != nil {
+			return err
+		}
+		config = k.withLocalRegistryConfig(config)
+	}
 	options := []cluster.CreateOption{
 		cluster.CreateWithKubeconfigPath(k.KubeConfigPath()),
 		cluster.CreateWithDisplayUsage(false),
@@ -282,7 +355,67 @@ func (k *Managed) Create(config *Cluster, timeout time.Duration) error {
 		options = append(options, cluster.CreateWithRetain(true))
 	}
 	k.Logger.Info("Create(): creating cluster", "kind-cluster-name", k.ClusterName())
-	return k.Provider.Create(k.ClusterName(), options...)
+	k.recordMetadata()
+	if err := k.Provider.Create(k.ClusterName(), options...); err != nil {
+		if !k.Retain {
+			// kind doesn't leave nodes behind unless asked to retain them
+			k.forgetMetadata()
+			if err := k.removeLocalRegistry(); err != nil {
+				k.Logger.Error(err, "failed to remove local registry", "kind-cluster-name", k.ClusterName())
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+func (k *Managed) CreateContext(ctx context.Context, config *Cluster) error {
+	var err error
+	switch {
+	case k.Reuse != nil:
+		err = k.reuseOrCreate(ctx, config, func() error { return k.createContext(ctx, config) })
+	case k.shared():
+		err = k.attachOrCreate(ctx, func() error { return k.createContext(ctx, config) })
+	default:
+		err = k.createContext(ctx, config)
+	}
+	if err != nil {
+		return err
+	}
+	return k.setupCreated(ctx)
+}
+
+func (k *Managed) createContext(ctx context.Context, config *Cluster) error {
+	timeout := provider.TimeoutFromContext(ctx, SharedTimeout)
+	return provider.RunContext(ctx, "Create", k.ClusterName(), func(ctx context.Context) error {
+		err := k.create(config, timeout)
+		// nodes could have been created after abort, if kind was past the point
+		// where it looks for them
+		if ctx.Err() != nil {
+			k.deleteHalfCreated()
+		}
+		return err
+	}, k.deleteHalfCreated)
+}
+
+func (k *Managed) deleteHalfCreated() {
+	k.Logger.Info("CreateContext(): deleting half-created cluster", "kind-cluster-name", k.ClusterName())
+	if err := k.Provider.Delete(k.ClusterName(), k.KubeConfigPath()); err != nil {
+		k.Logger.Error(err, "failed to delete half-created cluster", "kind-cluster-name", k.ClusterName())
+		return
+	}
+	if err := k.removeLocalRegistry(); err != nil {
+		k.Logger.Error(err, "failed to remove local registry", "kind-cluster-name", k.ClusterName())
+	}
+	k.forgetMetadata()
+}
+
+func (k *Managed) CollectLogsContext(ctx context.Context) error {
+	return provider.RunContext(ctx, "CollectLogs", k.ClusterName(), func(context.Context) error { return k.CollectLogs() }, nil)
+}
+
+func (k *Managed) DeleteContext(ctx context.Context) error {
+	return provider.RunContext(ctx, "Delete", k.ClusterName(), func(context.Context) error { return k.Delete() }, nil)
 }
 
 func (k *Managed) CollectLogs() error {
@@ -290,15 +423,102 @@ func (k *Managed) CollectLogs() error {
 	return k.Provider.CollectLogs(k.ClusterName(), k.LogsDir())
 }
 
+// Delete deletes the cluster, unless it was retained, is kept for reuse or is still used
+// by other holders of the shared cluster; in any case the kubeconfig is unmerged from the
+// user's one and the per-process kubeconfig is removed
 func (k *Managed) Delete() error {
+	return errors.Join(k.deleteOrKeep(), k.cleanupKubeConfig())
+}
+
+func (k *Managed) deleteOrKeep() error {
+	if k.retained {
+		k.Logger.Info("Delete(): no-op, cluster was retained", "kind-cluster-name", k.ClusterName())
+		return nil
+	}
+	if k.faulted {
+		if err := k.Heal(context.Background()); err != nil {
+			k.Logger.Error(err, "failed to heal nodes", "kind-cluster-name", k.ClusterName())
+		}
+	}
+	if k.Reuse != nil && k.retainForReuse() {
+		k.Logger.Info("Delete(): retaining cluster for reuse", "kind-cluster-name", k.ClusterName(), "kubeconfig", k.KubeConfigPath())
+		return nil
+	}
+	if k.shared() {
+		return k.release(context.Background())
+	}
+	return k.delete()
+}
+
+func (k *Managed) delete() error {
 	k.Logger.Info("Delete(): deleting cluster", "kind-cluster-name", k.ClusterName())
-	return k.Provider.Delete(k.ClusterName(), k.KubeConfigPath())
+	if err := k.Provider.Delete(k.ClusterName(), k.KubeConfigPath()); err != nil {
+		return err
+	}
+	if err := k.removeLocalRegistry(); err != nil {
+		return err
+	}
+	k.forgetMetadata()
+	return nil
 }
 
+// ClusterName is derived from the server address and CA of the cluster, so that it's
+// the same regardless of how the cluster was imported; it doesn't contact the cluster
 func (k *Unmanaged) ClusterName() string {
-	hash := crypto.SHA256.New()
-	_, _ = hash.Write([]byte(k.importedKubeconfigPath))
-	return ClusterNamePrefix + hex.EncodeToString(hash.Sum(nil))
+	k.clusterNameOnce.Do(func() {
+		hash := crypto.SHA256.New()
+		_, _ = hash.Write([]byte(k.clusterIdentity()))
+		k.clusterName = ClusterNamePrefix + hex.EncodeToString(hash.Sum(nil))
+	})
+	return k.clusterName
+}
+
+// clusterIdentity reads the CA file if there is no CA data, as is the case with in-cluster
+// config, so that the identity is the same as when importing the same cluster via kubeconfig
+func (k *Unmanaged) clusterIdentity() string {
+	clientConfig, err := k.unverifiedClientConfig()
+	if err != nil {
+		k.Logger.Error(err, "failed to load client config")
+		return fmt.Sprintf("%t\n%s\n%s\n%s", k.inCluster, k.importedKubeconfigPath, k.importedKubeconfigData, k.context)
+	}
+	caData := clientConfig.CAData
+	if len(caData) == 0 && clientConfig.CAFile != "" {
+		caData, err = os.ReadFile(clientConfig.CAFile)
+		if err != nil {
+			k.Logger.Error(err, "failed to read CA file", "ca-file", clientConfig.CAFile)
+			caData = []byte(clientConfig.CAFile)
+		}
+	}
+	return clientConfig.Host + "\n" + string(caData)
+}
+
+// KubeContext returns the context selected when the cluster was imported, it's
+// empty if the current context is used
+func (k *Unmanaged) KubeContext() string { return k.context }
+
+// NewClientConfig returns an error unless the cluster is marked as a test target,
+// see MarkTestTarget
+func (k *Unmanaged) NewClientConfig() (*rest.Config, error) {
+	if err := k.verifyTestTarget(context.Background()); err != nil {
+		return nil, err
+	}
+	return k.unverifiedClientConfig()
+}
+
+func (k *Unmanaged) unverifiedClientConfig() (*rest.Config, error) {
+	switch {
+	case k.inCluster:
+		return rest.InClusterConfig()
+	case k.importedKubeconfigData != nil:
+		config, err := clientcmd.Load(k.importedKubeconfigData)
+		if err != nil {
+			return nil, err
+		}
+		overrides := &clientcmd.ConfigOverrides{CurrentContext: k.context}
+		return clientcmd.NewDefaultClientConfig(*config, overrides).ClientConfig()
+	default:
+		return k.Common.NewClientConfig()
+	}
 }
 
 func (k *Unmanaged) KubeConfigPath() string { return k.importedKubeconfigPath }
@@ -309,38 +529,23 @@ func (k *Unmanaged) noop(fn string) error {
 	return nil
 }
 
-func (k *Unmanaged) Create(config *Cluster, timeout time.Duration) error { return k.noop("Create") }
-func (k *Unmanaged) CollectLogs() error                                  { return k.noop("CollectLogs") }
-func (k *Unmanaged) Delete() error                                       { return k.noop("Delete") }
-
-func (k Common[T]) NewClientConfig() (*rest.Config, error) {
-	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-		&clientcmd.ClientConfigLoadingRules{
-			ExplicitPath: k.k.KubeConfigPath(),
-		},
-		&clientcmd.ConfigOverrides{
-			// CurrentContext: Name + "-" + k.k.ClusterName(),
-		})
-
-	return loader.ClientConfig()
-}
-
-func (k Common[T]) NewClientMaker() (*clients.ClientMaker, error) {
-	clientConfig, err := k.NewClientConfig()
-	if err != nil {
-		return nil, err
+// Create only verifies that the cluster is marked as a test target
+func (k *Unmanaged) Create(config *Cluster, timeout time.Duration) error {
+	if err := k.verifyTestTarget(context.Background()); err != nil {
+		return err
 	}
-	return clients.NewClientMaker(clientConfig, Log), nil
+	return k.noop("Create")
 }
 
-func (k Common[T]) ApplyAddons(ctx context.Context, config addons.Config) error {
-	m, err := k.NewClientMaker()
-	if err != nil {
-		return err
-	}
-	rm, err := m.NewResourceManager()
-	if err != nil {
+func (k *Unmanaged) CollectLogs() error { return k.noop("CollectLogs") }
+func (k *Unmanaged) Delete() error      { return k.noop("Delete") }
+
+func (k *Unmanaged) CreateContext(ctx context.Context, _ *Cluster) error {
+	if err := k.verifyTestTarget(ctx); err != nil {
 		return err
 	}
-	return addons.Apply(ctx, rm, config)
+	return k.noop("CreateContext")
 }
+
+func (k *Unmanaged) CollectLogsContext(context.Context) error { return k.noop("CollectLogsContext") }
+func (k *Unmanaged) DeleteContext(context.Context) error      { return k.noop("DeleteContext") }
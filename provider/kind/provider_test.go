@@ -2,7 +2,10 @@ package kind_test
 
 import (
 	"context"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,9 +13,12 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	klog "k8s.io/klog/v2"
 
 	"github.com/errordeveloper/kube-test-env/addons"
+	"github.com/errordeveloper/kube-test-env/provider/fakeserver"
 	"github.com/errordeveloper/kube-test-env/provider/kind"
 )
 
@@ -107,6 +113,21 @@ func TestKindCreateAccessDelete(t *testing.T) {
 		g.Expect(clientConfig.TLSClientConfig.KeyData).ToNot(BeEmpty())
 		g.Expect(clientConfig.TLSClientConfig.CAData).ToNot(BeEmpty())
 
+		if managed, ok := k.(*kind.Managed); ok {
+			internalClientConfig, err := managed.NewInternalClientConfig()
+			g.Expect(err).NotTo(HaveOccurred())
+			// control-plane node or load balancer
+			g.Expect(internalClientConfig.Host).To(HavePrefix("https://" + k.ClusterName() + "-"))
+			g.Expect(internalClientConfig.TLSClientConfig.CertData).To(Equal(clientConfig.TLSClientConfig.CertData))
+
+			internalKubeConfigPath, err := managed.WriteInternalKubeConfig()
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(internalKubeConfigPath).To(BeAnExistingFile())
+			info, err := os.Stat(internalKubeConfigPath)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+		}
+
 		clients, err := k.NewClientMaker()
 		g.Expect(err).NotTo(HaveOccurred())
 		g.Expect(clients).NotTo(BeNil())
@@ -238,3 +259,723 @@ func TestKindSharedAndImorted(t *testing.T) {
 
 	t.Logf("Deleted cluster name=%q", k.ClusterName())
 }
+
+func TestKindSharedAcrossProcesses(t *testing.T) {
+	g := NewWithT(t)
+
+	useTempStateDir(t)
+
+	ctx := context.Background()
+
+	log := klog.FromContext(ctx)
+
+	stateFile := filepath.Join(t.TempDir(), "shared.json")
+
+	newHolder := func() *kind.Managed {
+		k := kind.New(t.TempDir(), log)
+		g.Expect(k).To(BeAssignableToTypeOf((*kind.Managed)(nil)))
+		k.(*kind.Managed).StateFile = stateFile
+		return k.(*kind.Managed)
+	}
+
+	// the second holder waits for the cluster that the first one is creating
+	k1, k2 := newHolder(), newHolder()
+	created := make(chan error, 1)
+	go func() { created <- k1.Create(nil, time.Minute*10) }()
+	g.Eventually(stateFile, time.Minute).Should(BeAnExistingFile())
+	g.Expect(k2.Create(nil, time.Minute*10)).To(Succeed())
+	g.Expect(<-created).To(Succeed())
+	g.Expect(k2.ClusterName()).To(Equal(k1.ClusterName()))
+	g.Expect(k2.KubeConfigPath()).To(Equal(k1.KubeConfigPath()))
+
+	g.Expect(k1.Delete()).To(Succeed())
+
+	clusters, err := k1.Provider.List()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(clusters).To(ContainElement(k1.ClusterName()))
+
+	g.Expect(k2.Delete()).To(Succeed())
+
+	clusters, err = k1.Provider.List()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(clusters).ToNot(ContainElement(k1.ClusterName()))
+	g.Expect(stateFile).NotTo(BeAnExistingFile())
+}
+
+func TestKindGC(t *testing.T) {
+	g := NewWithT(t)
+
+	log := klog.FromContext(context.Background())
+
+	useTempStateDir(t)
+
+	k := kind.New(t.TempDir(), log)
+
+	g.Expect(k.Create(nil, time.Minute*10)).To(Succeed())
+
+	md, err := kind.ReadMetadata(k.ClusterName())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(md).NotTo(BeNil())
+	g.Expect(md.PID).To(Equal(os.Getpid()))
+	g.Expect(md.KubeConfigPath).To(Equal(k.KubeConfigPath()))
+
+	orphanedNames := func(opts kind.GCOptions) []string {
+		orphaned, err := kind.FindOrphaned(opts)
+		g.Expect(err).NotTo(HaveOccurred())
+		names := []string{}
+		for _, o := range orphaned {
+			names = append(names, o.Name)
+		}
+		return names
+	}
+
+	g.Expect(orphanedNames(kind.GCOptions{Logger: log})).NotTo(ContainElement(k.ClusterName()))
+	g.Expect(orphanedNames(kind.GCOptions{Logger: log, TTL: time.Nanosecond})).To(ContainElement(k.ClusterName()))
+
+	orphaned, err := kind.GC(kind.GCOptions{Logger: log, TTL: time.Nanosecond, DryRun: true})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(orphaned).NotTo(BeEmpty())
+
+	clusters, err := kind.ListClusters(log)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(clusters).To(ContainElement(k.ClusterName()))
+
+	g.Expect(k.Delete()).To(Succeed())
+
+	md, err = kind.ReadMetadata(k.ClusterName())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(md).To(BeNil())
+}
+
+func TestKindLoadImages(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.Background()
+
+	log := klog.FromContext(ctx)
+
+	buildDir := t.TempDir()
+	g.Expect(os.WriteFile(filepath.Join(buildDir, "Dockerfile"), []byte("FROM scratch\nCOPY Dockerfile /\n"), 0o644)).To(Succeed())
+	image := "kte-test/load-images:" + strings.ToLower(t.Name())
+	g.Expect(exec.Command("docker", "build", "-t", image, buildDir).Run()).To(Succeed())
+	t.Cleanup(func() { _ = exec.Command("docker", "image", "rm", image).Run() })
+
+	k := kind.New(t.TempDir(), log)
+
+	g.Expect(k.Create(&kind.Cluster{
+		Nodes: []kind.Node{
+			{Role: kind.ControlPlaneRole},
+			{Role: kind.WorkerRole},
+		},
+	}, time.Minute*10)).To(Succeed())
+
+	managed := k.(*kind.Managed)
+
+	worker := k.ClusterName() + "-worker"
+	results, err := managed.LoadImagesOnNodes(ctx, []string{worker}, image)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(results).To(HaveLen(1))
+	g.Expect(results[0].Node).To(Equal(worker))
+	g.Expect(results[0].Loaded).To(ConsistOf(image))
+
+	results, err = managed.LoadImages(ctx, image)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(results).To(HaveLen(2))
+	for _, result := range results {
+		if result.Node == worker {
+			g.Expect(result.Skipped).To(ConsistOf(image))
+		} else {
+			g.Expect(result.Loaded).To(ConsistOf(image))
+		}
+	}
+
+	archive := filepath.Join(t.TempDir(), "images.tar")
+	g.Expect(exec.Command("docker", "save", "-o", archive, image).Run()).To(Succeed())
+
+	results, err = managed.LoadImageArchive(ctx, archive)
+	g.Expect(err).NotTo(HaveOccurred())
+	for _, result := range results {
+		g.Expect(result.Loaded).To(BeEmpty())
+		g.Expect(result.Skipped).To(ConsistOf(image))
+	}
+
+	g.Expect(k.Delete()).To(Succeed())
+}
+
+func TestKindLocalRegistry(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.Background()
+
+	log := klog.FromContext(ctx)
+
+	k := kind.New(t.TempDir(), log)
+
+	managed := k.(*kind.Managed)
+	managed.LocalRegistry = &kind.LocalRegistry{}
+
+	g.Expect(k.Create(nil, time.Minute*10)).To(Succeed())
+
+	g.Expect(managed.LocalRegistryHostAddress()).To(HavePrefix("localhost:"))
+	g.Expect(managed.LocalRegistryClusterAddress()).To(Equal(k.ClusterName() + "-registry:5000"))
+
+	clients, err := k.NewClientMaker()
+	g.Expect(err).NotTo(HaveOccurred())
+	clientSet, err := clients.NewClientSet()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	configMap, err := clientSet.CoreV1().ConfigMaps("kube-public").Get(ctx, "local-registry-hosting", metav1.GetOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(configMap.Data["localRegistryHosting.v1"]).To(ContainSubstring(managed.LocalRegistryHostAddress()))
+
+	g.Expect(k.Delete()).To(Succeed())
+
+	g.Expect(exec.Command("docker", "inspect", k.ClusterName()+"-registry").Run()).NotTo(Succeed())
+}
+
+func TestKindNodeImageCatalog(t *testing.T) {
+	g := NewWithT(t)
+
+	image, err := kind.NodeImageFor("v1.27.3")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(image).To(HavePrefix("kindest/node:v1.27.3@sha256:"))
+
+	_, err = kind.NodeImageFor("1.99")
+	g.Expect(err).To(HaveOccurred())
+
+	versions, err := kind.SupportedVersions()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(versions[0]).To(Equal("1.27"))
+
+	file := filepath.Join(t.TempDir(), "images.yaml")
+	g.Expect(os.WriteFile(file, []byte("v1.28: example.com/node:v1.28.0\n1.27: example.com/node:v1.27.0\n"), 0o644)).To(Succeed())
+	t.Setenv(kind.EnvNodeImagesFile, file)
+	t.Setenv(kind.EnvNodeImages, "1.27=example.com/node:v1.27.1")
+
+	image, err = kind.NodeImageFor("1.28")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(image).To(Equal("example.com/node:v1.28.0"))
+
+	image, err = kind.NodeImageFor("1.27")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(image).To(Equal("example.com/node:v1.27.1"))
+
+	versions, err = kind.SupportedVersions()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(versions[:2]).To(Equal([]string{"1.28", "1.27"}))
+
+	t.Setenv(kind.EnvNodeImages, "1.27")
+	_, err = kind.NodeImageFor("1.27")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestKindClusterBuilder(t *testing.T) {
+	g := NewWithT(t)
+
+	config, err := kind.NewClusterBuilder().
+		ControlPlanes(1, kind.WithPortMapping(30080, 8080)).
+		Workers(2, kind.WithNodeLabel("example.com/pool", "workers"), kind.WithExtraMount("/tmp", "/data", true)).
+		FeatureGate("InPlacePodVerticalScaling", true).
+		RuntimeConfig("api/alpha", "true").
+		PodSubnet("10.100.0.0/16").
+		KubeProxyMode(kind.IPVSProxyMode).
+		Build()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config.Nodes).To(HaveLen(3))
+	g.Expect(config.Nodes[2].Labels).To(HaveKeyWithValue("example.com/pool", "workers"))
+	g.Expect(config.FeatureGates).To(HaveKeyWithValue("InPlacePodVerticalScaling", true))
+
+	config, err = kind.NewClusterBuilder().Build()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config.Nodes).To(Equal([]kind.Node{{Role: kind.ControlPlaneRole}}))
+
+	config, err = kind.NewClusterBuilder().ControlPlanes(1).
+		Workers(1, kind.WithNodeTaint("a", "", corev1.TaintEffectNoSchedule), kind.WithNodeTaint("b", "c", corev1.TaintEffectNoExecute)).
+		Build()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config.Nodes[1].KubeadmConfigPatches).To(Equal([]string{`# taints set by WithNodeTaint
+kind: JoinConfiguration
+nodeRegistration:
+  taints:
+  - effect: NoSchedule
+    key: a
+  - effect: NoExecute
+    key: b
+    value: c
+`}))
+
+	rendered, err := kind.NewClusterBuilder().ControlPlanes(1).Workers(1).FeatureGate("Foo", false).Render()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(rendered)).To(Equal(`apiVersion: kind.x-k8s.io/v1alpha4
+featureGates:
+  Foo: false
+kind: Cluster
+networking: {}
+nodes:
+- role: control-plane
+- role: worker
+`))
+
+	for _, builder := range []*kind.ClusterBuilder{
+		kind.NewClusterBuilder().Workers(1),
+		kind.NewClusterBuilder().FeatureGate("Foo", true).FeatureGate("Foo", false),
+		kind.NewClusterBuilder().RuntimeConfig("api/alpha", "true").RuntimeConfig("api/alpha", "false"),
+		kind.NewClusterBuilder().ControlPlanes(1, kind.WithPortMapping(80, 8080)).Workers(1, kind.WithPortMapping(80, 8080)),
+		kind.NewClusterBuilder().APIServerPort(6443).ControlPlanes(1, kind.WithPortMapping(443, 6443)),
+		kind.NewClusterBuilder().ControlPlanes(1, kind.WithExtraMount("relative", "/data", false)),
+		kind.NewClusterBuilder().ControlPlanes(1, kind.WithNodeLabel("not a label", "")),
+		kind.NewClusterBuilder().IPFamily(kind.IPv6Family).PodSubnet("10.100.0.0/16"),
+		kind.NewClusterBuilder().ServiceSubnet("10.100.0.0"),
+		kind.NewClusterBuilder().Workers(-1),
+	} {
+		_, err := builder.Build()
+		g.Expect(err).To(HaveOccurred())
+		_, err = builder.Render()
+		g.Expect(err).To(HaveOccurred())
+	}
+}
+
+func TestKindConfigFile(t *testing.T) {
+	g := NewWithT(t)
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		g.Expect(os.MkdirAll(filepath.Dir(path), 0o755)).To(Succeed())
+		g.Expect(os.WriteFile(path, []byte(content), 0o644)).To(Succeed())
+		return path
+	}
+
+	config, err := kind.LoadConfig(write("valid.yaml", `
+cluster:
+  nodes:
+  - role: control-plane
+  - role: worker
+kubernetesVersion: "1.26"
+addons:
+  fluxComponents:
+    sourceController: true
+localRegistry: {}
+retain: on-failure
+timeout: 5m
+`))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config.Cluster.Nodes).To(HaveLen(2))
+	g.Expect(config.Addons.FluxComponents.SourceController).To(BeTrue())
+	g.Expect(config.Retain).To(Equal(kind.RetainOnFailure))
+	g.Expect(config.Timeout.Duration).To(Equal(5 * time.Minute))
+
+	for _, invalid := range []string{
+		"unknown: true\n",
+		"cluster:\n  nodes:\n  - role: control-plane\n    unknown: true\n",
+		"cluster:\n  nodes:\n  - role: worker\n",
+		"nodeImage: kindest/node:v1.27.3\nkubernetesVersion: '1.27'\n",
+		"kubernetesVersion: '1.99'\n",
+		"timeout: 0s\n",
+		"retain: sometimes\n",
+		"timeout: soon\n",
+	} {
+		_, err := kind.LoadConfig(write("invalid.yaml", invalid))
+		g.Expect(err).To(HaveOccurred(), invalid)
+	}
+
+	write("go.mod", "module example.com/test\n")
+	write("testdata/kte.yaml", "nodeImage: example.com/node:v1.27.0\n")
+	g.Expect(os.MkdirAll(filepath.Join(dir, "pkg", "foo"), 0o755)).To(Succeed())
+
+	wd, err := os.Getwd()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(os.Chdir(filepath.Join(dir, "pkg", "foo"))).To(Succeed())
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	config, err = kind.ConfigFromEnv()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config.NodeImage).To(Equal("example.com/node:v1.27.0"))
+
+	t.Setenv(kind.EnvConfig, filepath.Join(dir, "valid.yaml"))
+	config, err = kind.ConfigFromEnv()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config.KubernetesVersion).To(Equal("1.26"))
+}
+
+func TestKindReuse(t *testing.T) {
+	g := NewWithT(t)
+
+	log := klog.FromContext(context.Background())
+
+	useTempStateDir(t)
+
+	newManaged := func() *kind.Managed {
+		k := kind.New(t.TempDir(), log).(*kind.Managed)
+		k.Reuse = &kind.Reuse{Name: t.Name()}
+		return k
+	}
+
+	k1 := newManaged()
+	g.Expect(k1.Create(nil, time.Minute*10)).To(Succeed())
+	md1, err := kind.ReadMetadata(k1.ClusterName())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(md1.ConfigHash).NotTo(BeEmpty())
+	g.Expect(md1.ReuseUntil).NotTo(BeNil())
+	g.Expect(k1.Delete()).To(Succeed())
+
+	k2 := newManaged()
+	g.Expect(k2.Create(nil, time.Minute*10)).To(Succeed())
+	g.Expect(k2.ClusterName()).To(Equal(k1.ClusterName()))
+	g.Expect(k2.KubeConfigPath()).To(BeAnExistingFile())
+	md2, err := kind.ReadMetadata(k2.ClusterName())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(md2.Created).To(Equal(md1.Created))
+	g.Expect(k2.Delete()).To(Succeed())
+
+	// a different config results in a different cluster, the previous one is kept
+	k3 := newManaged()
+	k3.Reuse.Addons.FluxComponents.SourceController = true
+	g.Expect(k3.Create(nil, time.Minute*10)).To(Succeed())
+	g.Expect(k3.ClusterName()).NotTo(Equal(k1.ClusterName()))
+	md3, err := kind.ReadMetadata(k3.ClusterName())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(md3.ConfigHash).NotTo(Equal(md1.ConfigHash))
+
+	clusters, err := kind.ListClusters(log)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(clusters).To(ContainElements(k1.ClusterName(), k3.ClusterName()))
+
+	k2.Reuse = nil
+	g.Expect(k2.Delete()).To(Succeed())
+	k3.Reuse = nil
+	g.Expect(k3.Delete()).To(Succeed())
+
+	clusters, err = kind.ListClusters(log)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(clusters).NotTo(ContainElement(k1.ClusterName()))
+	g.Expect(clusters).NotTo(ContainElement(k3.ClusterName()))
+}
+
+func TestKindSnapshotRestore(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.Background()
+
+	log := klog.FromContext(ctx)
+
+	k := kind.New(t.TempDir(), log)
+
+	g.Expect(k.Create(nil, time.Minute*10)).To(Succeed())
+
+	managed := k.(*kind.Managed)
+
+	snapshot, err := managed.Snapshot(ctx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(snapshot.Path).To(BeAnExistingFile())
+
+	clients, err := k.NewClientMaker()
+	g.Expect(err).NotTo(HaveOccurred())
+	clientSet, err := clients.NewClientSet()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "created-after-snapshot"}}
+	_, err = clientSet.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	restoreCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	g.Expect(managed.Restore(restoreCtx, snapshot)).To(Succeed())
+
+	_, err = clientSet.CoreV1().Namespaces().Get(ctx, namespace.Name, metav1.GetOptions{})
+	g.Expect(err).To(HaveOccurred())
+
+	g.Expect(k.Delete()).To(Succeed())
+}
+
+func TestKindNodeFaults(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.Background()
+
+	log := klog.FromContext(ctx)
+
+	k := kind.New(t.TempDir(), log)
+
+	config, err := kind.NewClusterBuilder().ControlPlanes(1).Workers(1).Build()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(k.Create(config, time.Minute*10)).To(Succeed())
+
+	managed := k.(*kind.Managed)
+	worker := k.ClusterName() + "-worker"
+
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	g.Expect(managed.StopNode(ctx, worker)).To(Succeed())
+	g.Expect(managed.WaitForNodeReady(waitCtx, worker, false)).To(Succeed())
+	g.Expect(managed.StartNode(ctx, worker)).To(Succeed())
+	g.Expect(managed.WaitForNodeReady(waitCtx, worker, true)).To(Succeed())
+
+	g.Expect(managed.RestartKubelet(ctx, worker)).To(Succeed())
+	g.Expect(managed.RestartContainerd(ctx, worker)).To(Succeed())
+	g.Expect(managed.WaitForNodeReady(waitCtx, worker, true)).To(Succeed())
+
+	g.Expect(managed.StopNode(ctx, "unknown")).To(MatchError(ContainSubstring("not found")))
+
+	faults, err := os.ReadFile(managed.FaultsLogPath())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(strings.Split(strings.TrimSpace(string(faults)), "\n")).To(HaveLen(7))
+
+	g.Expect(k.Delete()).To(Succeed())
+}
+
+func TestKindNetworkFaults(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.Background()
+
+	log := klog.FromContext(ctx)
+
+	k := kind.New(t.TempDir(), log)
+
+	config, err := kind.NewClusterBuilder().ControlPlanes(1).Workers(1).Build()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(k.Create(config, time.Minute*10)).To(Succeed())
+
+	managed := k.(*kind.Managed)
+	controlPlane := k.ClusterName() + "-control-plane"
+	worker := k.ClusterName() + "-worker"
+
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	g.Expect(managed.Partition(ctx, worker, controlPlane)).To(Succeed())
+	g.Expect(managed.WaitForNodeReady(waitCtx, worker, false)).To(Succeed())
+	g.Expect(managed.Heal(ctx)).To(Succeed())
+	g.Expect(managed.WaitForNodeReady(waitCtx, worker, true)).To(Succeed())
+
+	g.Expect(managed.AddLatency(ctx, worker, 100*time.Millisecond)).To(Succeed())
+	g.Expect(managed.WaitForNodeReady(waitCtx, worker, true)).To(Succeed())
+
+	g.Expect(k.Delete()).To(Succeed())
+}
+
+func TestKindAddRemoveNodes(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.Background()
+
+	log := klog.FromContext(ctx)
+
+	k := kind.New(t.TempDir(), log)
+
+	g.Expect(k.Create(nil, time.Minute*10)).To(Succeed())
+
+	managed := k.(*kind.Managed)
+
+	addCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	_, err := managed.AddNodes(addCtx, kind.ControlPlaneRole, 1)
+	g.Expect(err).To(HaveOccurred())
+
+	names, err := managed.AddNodes(addCtx, kind.WorkerRole, 2,
+		kind.WithNodeLabel("node-role.kubernetes.io/worker", ""),
+		kind.WithNodeTaint("example.com/dedicated", "test", corev1.TaintEffectNoSchedule))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(names).To(Equal([]string{k.ClusterName() + "-worker", k.ClusterName() + "-worker2"}))
+
+	clients, err := k.NewClientMaker()
+	g.Expect(err).NotTo(HaveOccurred())
+	clientSet, err := clients.NewClientSet()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	node, err := clientSet.CoreV1().Nodes().Get(ctx, names[1], metav1.GetOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(node.Labels).To(HaveKey("node-role.kubernetes.io/worker"))
+	g.Expect(node.Spec.Taints).To(ContainElement(HaveField("Key", "example.com/dedicated")))
+
+	g.Expect(managed.RemoveNode(addCtx, names[0])).To(Succeed())
+	nodes, err := clientSet.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(nodes.Items).To(HaveLen(2))
+
+	g.Expect(managed.RemoveNode(addCtx, k.ClusterName()+"-control-plane")).To(HaveOccurred())
+
+	g.Expect(k.Delete()).To(Succeed())
+}
+
+func TestKindKubeConfig(t *testing.T) {
+	g := NewWithT(t)
+
+	managed := kind.New(t.TempDir(), klog.Background()).(*kind.Managed)
+	g.Expect(managed.KubeContext()).To(Equal("kind-" + managed.ClusterName()))
+
+	config := clientcmdapi.NewConfig()
+	config.Clusters[managed.KubeContext()] = &clientcmdapi.Cluster{Server: "https://127.0.0.1:6443"}
+	config.AuthInfos[managed.KubeContext()] = &clientcmdapi.AuthInfo{Token: "admin"}
+	config.Contexts[managed.KubeContext()] = &clientcmdapi.Context{Cluster: managed.KubeContext(), AuthInfo: managed.KubeContext()}
+	config.Contexts["other"] = &clientcmdapi.Context{Cluster: managed.KubeContext(), AuthInfo: managed.KubeContext(), Namespace: "other"}
+	config.CurrentContext = "other"
+	g.Expect(os.MkdirAll(filepath.Dir(managed.KubeConfigPath()), 0o755)).To(Succeed())
+	g.Expect(clientcmd.WriteToFile(*config, managed.KubeConfigPath())).To(Succeed())
+
+	managed.ExtraContexts = []kind.ExtraContext{{Name: "viewer", User: "jane", Groups: []string{"viewers"}}}
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	g.Expect(managed.WriteKubeConfig(path, kind.ExtraContext{Name: "test", Namespace: "test"})).To(Succeed())
+
+	written, err := clientcmd.LoadFromFile(path)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(written.Contexts).To(HaveKey(managed.KubeContext()))
+	g.Expect(written.Contexts).To(HaveKeyWithValue(managed.KubeContext()+"-test", HaveField("Namespace", "test")))
+	g.Expect(written.AuthInfos).To(HaveKeyWithValue(managed.KubeContext()+"-viewer", And(
+		HaveField("Token", "admin"),
+		HaveField("Impersonate", "jane"),
+		HaveField("ImpersonateGroups", []string{"viewers"}),
+	)))
+
+	// the default context is used regardless of the current context
+	clientConfig, err := managed.NewClientConfig()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(clientConfig.Host).To(Equal("https://127.0.0.1:6443"))
+	g.Expect(clientConfig.BearerToken).To(Equal("admin"))
+
+	g.Expect(managed.WriteKubeConfig(path, kind.ExtraContext{})).NotTo(Succeed())
+}
+
+func TestKindMergeKubeConfig(t *testing.T) {
+	g := NewWithT(t)
+
+	userKubeConfig := filepath.Join(t.TempDir(), "config")
+	t.Setenv("KUBECONFIG", userKubeConfig)
+	t.Setenv(kind.EnvMergeKubeConfig, "true")
+
+	k := kind.New(t.TempDir(), klog.Background())
+	managed := k.(*kind.Managed)
+	g.Expect(managed.MergeKubeConfig).To(BeTrue())
+	managed.ExtraContexts = []kind.ExtraContext{{Name: "test", Namespace: "test"}}
+
+	g.Expect(k.Create(nil, time.Minute*10)).To(Succeed())
+
+	merged, err := clientcmd.LoadFromFile(userKubeConfig)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(merged.CurrentContext).To(Equal(managed.KubeContext()))
+	g.Expect(merged.Contexts).To(HaveKey(managed.KubeContext() + "-test"))
+
+	// extra contexts are only written to the kubeconfig of this process
+	processConfig, err := clientcmd.LoadFromFile(managed.ProcessKubeConfigPath())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(processConfig.Contexts).To(HaveKey(managed.KubeContext() + "-test"))
+	kindConfig, err := clientcmd.LoadFromFile(managed.KubeConfigPath())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(kindConfig.Contexts).NotTo(HaveKey(managed.KubeContext() + "-test"))
+
+	g.Expect(k.Delete()).To(Succeed())
+	g.Expect(managed.ProcessKubeConfigPath()).NotTo(BeAnExistingFile())
+
+	merged, err = clientcmd.LoadFromFile(userKubeConfig)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(merged.CurrentContext).To(BeEmpty())
+	g.Expect(merged.Contexts).To(BeEmpty())
+}
+
+func TestKindUnmanaged(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.Background()
+
+	log := klog.FromContext(ctx)
+
+	server := fakeserver.New(t.TempDir(), log)
+	g.Expect(server.Create()).To(Succeed())
+	defer server.Delete()
+
+	config, err := clientcmd.LoadFromFile(server.KubeConfigPath())
+	g.Expect(err).NotTo(HaveOccurred())
+	config.Clusters["unreachable"] = &clientcmdapi.Cluster{Server: "https://127.0.0.1:1"}
+	config.AuthInfos["unreachable"] = &clientcmdapi.AuthInfo{Token: "unreachable"}
+	config.Contexts["unreachable"] = &clientcmdapi.Context{Cluster: "unreachable", AuthInfo: "unreachable"}
+	config.CurrentContext = "unreachable"
+	data, err := clientcmd.Write(*config)
+	g.Expect(err).NotTo(HaveOccurred())
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	g.Expect(os.WriteFile(path, data, 0o600)).To(Succeed())
+
+	// CA is referenced by path, as it is with in-cluster config
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	g.Expect(os.WriteFile(caFile, config.Clusters[server.ClusterName()].CertificateAuthorityData, 0o600)).To(Succeed())
+	caFileConfig := config.DeepCopy()
+	caFileConfig.Clusters[server.ClusterName()].CertificateAuthorityData = nil
+	caFileConfig.Clusters[server.ClusterName()].CertificateAuthority = caFile
+	caFileData, err := clientcmd.Write(*caFileConfig)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(kind.MarkTestTarget(ctx, server)).To(Succeed())
+
+	names := []string{}
+	for _, unmanaged := range []*kind.Unmanaged{
+		kind.NewUnmanagedWithContext(log, path, server.ClusterName()),
+		kind.NewUnmanagedFromBytes(log, data, server.ClusterName()),
+		kind.NewUnmanagedFromBytes(log, caFileData, server.ClusterName()),
+	} {
+		clientConfig, err := unmanaged.NewClientConfig()
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(clientConfig.Host).To(Equal(server.Server.URL))
+
+		clients, err := unmanaged.NewClientMaker()
+		g.Expect(err).NotTo(HaveOccurred())
+		clientSet, err := clients.NewClientSet()
+		g.Expect(err).NotTo(HaveOccurred())
+		_, err = clientSet.CoreV1().Namespaces().Get(ctx, metav1.NamespaceSystem, metav1.GetOptions{})
+		g.Expect(err).NotTo(HaveOccurred())
+
+		names = append(names, unmanaged.ClusterName())
+	}
+	// name doesn't depend on how the cluster was imported
+	g.Expect(names[0]).To(HavePrefix(kind.ClusterNamePrefix))
+	g.Expect(names[0]).To(Equal(names[1]))
+	g.Expect(names[0]).To(Equal(names[2]))
+
+	// current context is unreachable, so its name is derived from the server address
+	g.Expect(kind.NewUnmanaged(log, path).ClusterName()).NotTo(Equal(names[0]))
+
+	// different kubeconfigs that cannot be loaded still get different names
+	g.Expect(kind.NewUnmanagedFromBytes(log, []byte("foo"), "").ClusterName()).
+		NotTo(Equal(kind.NewUnmanagedFromBytes(log, []byte("bar"), "").ClusterName()))
+
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	_, err = kind.NewUnmanagedInCluster(log).NewClientConfig()
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestKindTestTarget(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.Background()
+
+	log := klog.FromContext(ctx)
+
+	server := fakeserver.New(t.TempDir(), log)
+	g.Expect(server.Create()).To(Succeed())
+	defer server.Delete()
+
+	unmanaged := kind.NewUnmanaged(log, server.KubeConfigPath())
+	_, err := unmanaged.NewClientMaker()
+	g.Expect(err).To(MatchError(ContainSubstring("not marked as a test target")))
+	g.Expect(unmanaged.Create(nil, time.Minute)).To(MatchError(ContainSubstring("not marked as a test target")))
+
+	t.Setenv(kind.EnvAllowUnmarkedTarget, "true")
+	_, err = kind.NewUnmanaged(log, server.KubeConfigPath()).NewClientMaker()
+	g.Expect(err).NotTo(HaveOccurred())
+	t.Setenv(kind.EnvAllowUnmarkedTarget, "")
+
+	g.Expect(kind.MarkTestTarget(ctx, unmanaged)).To(Succeed())
+	// marking twice is fine
+	g.Expect(kind.MarkTestTarget(ctx, unmanaged)).To(Succeed())
+	g.Expect(unmanaged.Create(nil, time.Minute)).To(Succeed())
+	_, err = unmanaged.NewClientMaker()
+	g.Expect(err).NotTo(HaveOccurred())
+}
+
+// useTempStateDir points kind.StateDir to a temporary directory for the duration of the test
+func useTempStateDir(t *testing.T) {
+	stateDir := kind.StateDir
+	kind.StateDir = t.TempDir()
+	t.Cleanup(func() { kind.StateDir = stateDir })
+}
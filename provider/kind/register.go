@@ -0,0 +1,86 @@
+package kind
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/errordeveloper/kube-test-env/provider"
+)
+
+func init() {
+	provider.Register(Name, newLifecycle)
+}
+
+// lifecycle adapts KindLifecycle to the backend-neutral provider.Lifecycle,
+// cluster config and timeout are taken from provider.Options, unless they are
+// set in the config file
+type lifecycle struct {
+	KindLifecycle
+
+	config  *Cluster
+	timeout time.Duration
+}
+
+func newLifecycle(opts provider.Options) (provider.Lifecycle, error) {
+	fileConfig, err := ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	k := New(opts.ArtifactDir, opts.Logger)
+	fileConfig.applyTo(k)
+	if managed, ok := k.(*Managed); ok && opts.Shared && SharedStateFile != "" {
+		if fileLockingSupported {
+			managed.StateFile = SharedStateFile
+		} else {
+			opts.Logger.Info("file locking is not supported, cluster won't be shared across processes",
+				"provider", Name, "state-file", SharedStateFile)
+		}
+	}
+	l := &lifecycle{
+		KindLifecycle: k,
+		timeout:       opts.Timeout,
+	}
+	switch config := opts.Config.(type) {
+	case nil:
+	case *Cluster:
+		l.config = config
+	case Cluster:
+		l.config = &config
+	default:
+		return nil, fmt.Errorf("unsupported config type %T for provider '%s'", opts.Config, Name)
+	}
+	setInCode := []string{}
+	if l.config != nil {
+		setInCode = append(setInCode, "cluster")
+	}
+	if l.timeout != 0 {
+		setInCode = append(setInCode, "timeout")
+	}
+	fileConfig.logOverrides(opts.Logger, setInCode...)
+	l.config = fileConfig.clusterOr(l.config)
+	l.timeout = fileConfig.timeoutOr(l.timeout)
+	if l.timeout == 0 {
+		l.timeout = SharedTimeout
+	}
+	return l, nil
+}
+
+func (l *lifecycle) Create() error { return l.KindLifecycle.Create(l.config, l.timeout) }
+
+func (l *lifecycle) CreateContext(ctx context.Context) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.timeout)
+		defer cancel()
+	}
+	return l.KindLifecycle.CreateContext(ctx, l.config)
+}
+
+func (l *lifecycle) CanReset(ctx context.Context) error {
+	if checker, ok := l.KindLifecycle.(provider.ResetChecker); ok {
+		return checker.CanReset(ctx)
+	}
+	return nil
+}
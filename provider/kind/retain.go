@@ -0,0 +1,136 @@
+package kind
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	klog "k8s.io/klog/v2"
+)
+
+type RetainPolicy string
+
+const (
+	RetainNever     RetainPolicy = "never"
+	RetainOnFailure RetainPolicy = "on-failure"
+	RetainAlways    RetainPolicy = "always"
+
+	// EnvRetain overrides the retain policy set in code or in the config file
+	EnvRetain = "KTE_RETAIN"
+)
+
+// RetainedDir is where kubeconfig of retained clusters is copied to, as the artifact
+// directory may be removed once the tests complete
+var RetainedDir = filepath.Join(os.TempDir(), "kte", "retained")
+
+func (p RetainPolicy) validate() error {
+	switch p {
+	case "", RetainNever, RetainOnFailure, RetainAlways:
+		return nil
+	default:
+		return fmt.Errorf("invalid retain policy %q, expected one of '%s', '%s' or '%s'", p, RetainNever, RetainOnFailure, RetainAlways)
+	}
+}
+
+func (p RetainPolicy) retain(failed bool) bool {
+	return p == RetainAlways || (p == RetainOnFailure && failed)
+}
+
+// retainPolicyFromEnv returns the policy set by EnvRetain, the config file or code,
+// in that order of precedence
+func retainPolicyFromEnv(fileConfig *Config, policy RetainPolicy) (RetainPolicy, error) {
+	if value := RetainPolicy(os.Getenv(EnvRetain)); value != "" {
+		return value, value.validate()
+	}
+	if fileConfig.Retain != "" {
+		return fileConfig.Retain, nil
+	}
+	return policy, policy.validate()
+}
+
+// retain keeps the cluster for inspection, Delete becomes a no-op and kubeconfig is
+// copied to RetainedDir; it returns instructions for accessing and deleting the cluster
+func (k *Managed) retain() (string, error) {
+	data, err := os.ReadFile(k.KubeConfigPath())
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(RetainedDir, 0o755); err != nil {
+		return "", err
+	}
+	kubeconfigPath := filepath.Join(RetainedDir, k.ClusterName()+".kubeconfig")
+	if err := os.WriteFile(kubeconfigPath, data, 0o600); err != nil {
+		return "", err
+	}
+
+	md, err := ReadMetadata(k.ClusterName())
+	if err != nil {
+		return "", err
+	}
+	if md == nil {
+		md = k.newMetadata()
+	}
+	md.Retained = true
+	md.KubeConfigPath = kubeconfigPath
+	if err := writeMetadata(md); err != nil {
+		return "", err
+	}
+	k.retained = true
+
+	if k.stopRenew != nil {
+		k.stopRenew()
+		k.stopRenew = nil
+	}
+
+	message := fmt.Sprintf("Retained cluster %q, to access it run 'export KUBECONFIG=%s',"+
+		" to delete it run 'go run github.com/errordeveloper/kube-test-env/cmd/kte-gc -cluster %s'",
+		k.ClusterName(), kubeconfigPath, k.ClusterName())
+	k.Logger.Info("Retain(): "+message, "kind-cluster-name", k.ClusterName(), "kubeconfig", kubeconfigPath)
+	return message, nil
+}
+
+func isRetained(name string) bool {
+	md, err := ReadMetadata(name)
+	return err == nil && md != nil && md.Retained
+}
+
+// retainIfManaged retains k if it's a managed cluster, it can also be an instance of
+// provider.Lifecycle returned by provider.Shared
+func retainIfManaged(k KindProvider) (string, error) {
+	if l, ok := k.(*lifecycle); ok {
+		k = l.KindLifecycle
+	}
+	managed, ok := k.(*Managed)
+	if !ok {
+		return "", fmt.Errorf("cannot retain cluster %q as it's not managed", k.ClusterName())
+	}
+	return managed.retain()
+}
+
+// DeleteCluster deletes a cluster by name, e.g. one that was retained
+func DeleteCluster(logger klog.Logger, name string) error {
+	md, err := ReadMetadata(name)
+	if err != nil {
+		return err
+	}
+	kubeconfigPath := ""
+	if md != nil {
+		kubeconfigPath = md.KubeConfigPath
+	}
+	logger.Info("DeleteCluster(): deleting cluster", "kind-cluster-name", name)
+	errs := []error{}
+	if err := newKindProvider(logger).Delete(name, kubeconfigPath); err != nil {
+		return fmt.Errorf("failed to delete cluster %q: %w", name, err)
+	}
+	if err := removeLocalRegistryContainer(name); err != nil {
+		errs = append(errs, err)
+	}
+	if err := removeMetadata(name); err != nil {
+		errs = append(errs, err)
+	}
+	if err := os.Remove(filepath.Join(RetainedDir, name+".kubeconfig")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,153 @@
+package kind
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/errordeveloper/kube-test-env/addons"
+)
+
+// EnvReuse enables Reuse for all managed clusters, its value is used as Reuse.Name
+// unless it's 'true'
+const EnvReuse = "KTE_REUSE"
+
+var DefaultReuseTTL = 12 * time.Hour
+
+// reuseNamespace is used for deriving cluster UUIDs from Reuse.Name and config hash
+var reuseNamespace = uuid.MustParse("0f2b6a55-8f1d-4c51-9d2c-6f7b0f7f3c1e")
+
+// Reuse keeps the cluster after Delete, so that it's attached to by Create in subsequent
+// runs, as long as the TTL hasn't lapsed; the config hash is part of the cluster name,
+// so a cluster with a different config is left for kte-gc and a new one is created
+type Reuse struct {
+	// Name identifies the cluster across runs, it defaults to the working directory,
+	// i.e. there is one cluster per package
+	Name string
+	// TTL defaults to DefaultReuseTTL
+	TTL time.Duration
+	// Addons are only used for computing the hash, as they are applied after Create
+	Addons addons.Config
+}
+
+func reuseFromEnv() *Reuse {
+	value, ok := os.LookupEnv(EnvReuse)
+	if !ok || value == "" || value == "false" {
+		return nil
+	}
+	if value == "true" {
+		return &Reuse{}
+	}
+	return &Reuse{Name: value}
+}
+
+func (k *Managed) reuseTTL() time.Duration {
+	if k.Reuse.TTL > 0 {
+		return k.Reuse.TTL
+	}
+	return DefaultReuseTTL
+}
+
+func (k *Managed) configHash(config *Cluster) (string, error) {
+	if config == nil {
+		config = &Cluster{}
+	}
+	data, err := json.Marshal(struct {
+		Cluster       *Cluster
+		NodeImage     string
+		Addons        addons.Config
+		LocalRegistry bool
+	}{config, k.NodeImage, k.Reuse.Addons, k.LocalRegistry != nil})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// reuseOrCreate attaches to the cluster created by a previous run with the same name
+// and config hash if it hasn't expired, or calls create otherwise
+func (k *Managed) reuseOrCreate(ctx context.Context, config *Cluster, create func() error) error {
+	name := k.Reuse.Name
+	if name == "" {
+		var err error
+		if name, err = os.Getwd(); err != nil {
+			return err
+		}
+	}
+	hash, err := k.configHash(config)
+	if err != nil {
+		return err
+	}
+	k.UUID = uuid.NewSHA1(reuseNamespace, []byte(name+hash))
+	k.Logger = k.Logger.WithValues("kind-provider-uuid", k.UUID.String())
+	k.configHashValue = hash
+
+	if err := os.MkdirAll(StateDir, 0o755); err != nil {
+		return err
+	}
+	// without file locking, concurrent runs may race to create the cluster
+	if fileLockingSupported {
+		unlock, err := lockFile(ctx, metadataPath(k.ClusterName())+".lock")
+		if err != nil {
+			return fmt.Errorf("cannot lock metadata of cluster %q: %w", k.ClusterName(), err)
+		}
+		defer unlock()
+	}
+
+	clusters, err := k.Provider.List()
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(clusters, k.ClusterName()) {
+		return create()
+	}
+	md, err := ReadMetadata(k.ClusterName())
+	if err != nil {
+		return err
+	}
+	switch {
+	case md == nil:
+		// the hash is part of the name, so the cluster has the same config
+		k.Logger.Info("Create(): reusing cluster without metadata", "kind-cluster-name", k.ClusterName(), "config-hash", hash)
+		k.recordMetadata()
+	case md.ConfigHash != hash:
+		return fmt.Errorf("cannot reuse cluster %q, it was created with config hash %q instead of %q",
+			k.ClusterName(), md.ConfigHash, hash)
+	case md.ReuseUntil != nil && time.Now().After(*md.ReuseUntil):
+		k.Logger.Info("Create(): re-creating expired cluster", "kind-cluster-name", k.ClusterName(), "expired", md.ReuseUntil)
+		if err := k.delete(); err != nil {
+			return err
+		}
+		return create()
+	default:
+		k.Logger.Info("Create(): reusing cluster", "kind-cluster-name", k.ClusterName(), "config-hash", hash, "created", md.Created)
+		// this process becomes the owner, so that GC doesn't delete the cluster while it's in use
+		md.PID = os.Getpid()
+		md.Hostname, _ = os.Hostname()
+		if err := writeMetadata(md); err != nil {
+			k.Logger.Error(err, "failed to record cluster metadata", "kind-cluster-name", k.ClusterName(), "state-dir", StateDir)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(k.KubeConfigPath()), 0o755); err != nil {
+		return err
+	}
+	return k.Provider.ExportKubeConfig(k.ClusterName(), k.KubeConfigPath(), false)
+}
+
+// retainForReuse returns true if the cluster should be kept for subsequent runs
+func (k *Managed) retainForReuse() bool {
+	md, err := ReadMetadata(k.ClusterName())
+	if err != nil || md == nil || md.ConfigHash != k.configHashValue {
+		return false
+	}
+	return md.ReuseUntil == nil || time.Now().Before(*md.ReuseUntil)
+}
@@ -0,0 +1,314 @@
+package kind
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const EnvSharedStateFile = "KTE_SHARED_STATE_FILE"
+
+var (
+	// SharedStateFile enables sharing of the cluster created by Shared across processes,
+	// e.g. test binaries of different packages run by 'go test ./...'; the first process
+	// creates the cluster and records it in this file, others attach to it, and each
+	// one holds a lease, so that the cluster is deleted by SharedDelete of the last holder
+	SharedStateFile = os.Getenv(EnvSharedStateFile)
+
+	// SharedLeaseTTL is how long a lease is valid for unless renewed, holders renew
+	// their leases in the background, so it only matters when a holder goes away
+	// without calling SharedDelete and it's not possible to tell if its process is
+	// still running (i.e. it's on a different host)
+	SharedLeaseTTL = 5 * time.Minute
+)
+
+// sharedStatePollInterval is how often processes check if the cluster that
+// another process is creating is ready
+var sharedStatePollInterval = time.Second
+
+// shared returns true when the cluster is shared across processes, StateFile is
+// ignored on platforms without file locking
+func (k *Managed) shared() bool {
+	return k.StateFile != "" && fileLockingSupported
+}
+
+type sharedState struct {
+	UUID        uuid.UUID `json:"uuid"`
+	ArtifactDir string    `json:"artifactDir"`
+	// Creating is set while the holder of the first lease is creating the cluster,
+	// the lock is not held during creation, so that other processes can see it
+	Creating bool      `json:"creating,omitempty"`
+	Created  time.Time `json:"created,omitempty"`
+	Leases   []lease   `json:"leases"`
+}
+
+type lease struct {
+	ID       string    `json:"id"`
+	PID      int       `json:"pid"`
+	Hostname string    `json:"hostname"`
+	Expires  time.Time `json:"expires"`
+}
+
+func (l lease) valid(hostname string, now time.Time) bool {
+	if now.After(l.Expires) {
+		return false
+	}
+	return l.Hostname != hostname || processAlive(l.PID)
+}
+
+func readSharedState(path string) (*sharedState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) || len(data) == 0 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &sharedState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("cannot parse shared state file %q: %w", path, err)
+	}
+	return state, nil
+}
+
+func writeSharedState(path string, state *sharedState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// withSharedState calls fn with the state read from the file while holding the lock,
+// state is nil if there is no cluster recorded yet; the state that fn returns is
+// written back, or the file is removed if it's nil
+func (k *Managed) withSharedState(ctx context.Context, fn func(*sharedState) (*sharedState, error)) error {
+	if err := os.MkdirAll(filepath.Dir(k.StateFile), 0o755); err != nil {
+		return err
+	}
+	unlock, err := lockFile(ctx, k.StateFile+".lock")
+	if err != nil {
+		return fmt.Errorf("cannot lock shared state file %q: %w", k.StateFile, err)
+	}
+	defer unlock()
+
+	state, err := readSharedState(k.StateFile)
+	if err != nil {
+		return err
+	}
+	if state != nil {
+		state.dropExpiredLeases()
+	}
+
+	state, err = fn(state)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		if err := os.Remove(k.StateFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return writeSharedState(k.StateFile, state)
+}
+
+// dropExpiredLeases discards leases of processes that have exited or that haven't
+// been renewed, it's done on every access, so attach and release never count them
+func (s *sharedState) dropExpiredLeases() {
+	hostname, _ := os.Hostname()
+	now := time.Now()
+	s.Leases = slices.DeleteFunc(s.Leases, func(l lease) bool { return !l.valid(hostname, now) })
+}
+
+func (s *sharedState) dropLease(id string) {
+	s.Leases = slices.DeleteFunc(s.Leases, func(l lease) bool { return l.ID == id })
+}
+
+func (k *Managed) newLease() lease {
+	hostname, _ := os.Hostname()
+	return lease{
+		ID:       k.leaseID,
+		PID:      os.Getpid(),
+		Hostname: hostname,
+		Expires:  time.Now().Add(SharedLeaseTTL),
+	}
+}
+
+// attachOrCreate attaches to the cluster recorded in the state file if it still exists,
+// or calls create otherwise, and then takes a lease on the cluster; when another process
+// is creating the cluster, it waits for it to finish, or takes over if that process
+// has gone away
+func (k *Managed) attachOrCreate(ctx context.Context, create func() error) error {
+	k.leaseID = uuid.NewString()
+
+	for {
+		creating, attached := false, false
+		err := k.withSharedState(ctx, func(state *sharedState) (*sharedState, error) {
+			switch {
+			case state == nil:
+			case state.Creating && len(state.Leases) > 0:
+				k.Logger.V(1).Info("Create(): waiting for shared cluster to be created by another process",
+					"kind-cluster-name", ClusterNamePrefix+state.UUID.String(), "state-file", k.StateFile)
+				return state, nil
+			case state.Creating:
+				k.Logger.Info("Create(): process creating shared cluster has gone away",
+					"kind-cluster-name", ClusterNamePrefix+state.UUID.String(), "state-file", k.StateFile)
+			default:
+				clusters, err := k.Provider.List()
+				if err != nil {
+					return nil, err
+				}
+				name := ClusterNamePrefix + state.UUID.String()
+				if slices.Contains(clusters, name) {
+					k.UUID = state.UUID
+					k.ArtifactDir = state.ArtifactDir
+					k.Logger = k.Logger.WithValues("kind-provider-uuid", state.UUID.String())
+					k.Logger.Info("Create(): attaching to shared cluster", "kind-cluster-name", name,
+						"state-file", k.StateFile, "leases", len(state.Leases))
+					state.Leases = append(state.Leases, k.newLease())
+					attached = true
+					return state, nil
+				}
+				k.Logger.Info("Create(): shared cluster no longer exists", "kind-cluster-name", name, "state-file", k.StateFile)
+			}
+			creating = true
+			return &sharedState{
+				UUID:        k.UUID,
+				ArtifactDir: k.ArtifactDir,
+				Creating:    true,
+				Leases:      []lease{k.newLease()},
+			}, nil
+		})
+		if err != nil {
+			return err
+		}
+		if attached {
+			break
+		}
+		if creating {
+			if err := k.createShared(create); err != nil {
+				return err
+			}
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(sharedStatePollInterval):
+		}
+	}
+
+	renewCtx, stopRenew := context.WithCancel(context.Background())
+	k.stopRenew = stopRenew
+	go k.renewLease(renewCtx)
+	return nil
+}
+
+// createShared calls create without holding the lock, the lease is renewed meanwhile,
+// so that waiting processes can tell that creation is still in progress; when create
+// fails the state is removed, and the next waiting process attempts to create the cluster
+func (k *Managed) createShared(create func() error) error {
+	renewCtx, stopRenew := context.WithCancel(context.Background())
+	go k.renewLease(renewCtx)
+	createErr := create()
+	stopRenew()
+
+	// ctx is likely to be done if create failed, but the state has to be updated
+	// regardless, or waiting processes are blocked until the lease expires
+	stateCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err := k.withSharedState(stateCtx, func(state *sharedState) (*sharedState, error) {
+		if state == nil || state.UUID != k.UUID {
+			// another process took over, which only happens if the lease expired
+			return state, fmt.Errorf("shared state file %q was taken over while creating cluster %q", k.StateFile, k.ClusterName())
+		}
+		if createErr != nil {
+			return nil, nil
+		}
+		state.Creating = false
+		state.Created = time.Now()
+		return state, nil
+	})
+	return errors.Join(createErr, err)
+}
+
+func (k *Managed) renewLease(ctx context.Context) {
+	ticker := time.NewTicker(SharedLeaseTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := k.withSharedState(ctx, func(state *sharedState) (*sharedState, error) {
+			if state == nil || state.UUID != k.UUID {
+				return state, nil
+			}
+			state.dropLease(k.leaseID)
+			state.Leases = append(state.Leases, k.newLease())
+			return state, nil
+		})
+		if err != nil && ctx.Err() == nil {
+			k.Logger.Error(err, "failed to renew lease on shared cluster", "state-file", k.StateFile)
+		}
+	}
+}
+
+// CanReset returns an error if other processes hold leases on the cluster, as they may
+// be using objects that SharedReset would delete
+func (k *Managed) CanReset(ctx context.Context) error {
+	if !k.shared() {
+		return nil
+	}
+	others := 0
+	err := k.withSharedState(ctx, func(state *sharedState) (*sharedState, error) {
+		if state != nil && state.UUID == k.UUID {
+			others = len(slices.DeleteFunc(slices.Clone(state.Leases), func(l lease) bool { return l.ID == k.leaseID }))
+		}
+		return state, nil
+	})
+	if err != nil {
+		return err
+	}
+	if others > 0 {
+		return fmt.Errorf("cluster %q is shared with %d other processes", k.ClusterName(), others)
+	}
+	return nil
+}
+
+// release drops the lease and deletes the cluster if there are no other holders left
+func (k *Managed) release(ctx context.Context) error {
+	if k.stopRenew != nil {
+		k.stopRenew()
+		k.stopRenew = nil
+	}
+	return k.withSharedState(ctx, func(state *sharedState) (*sharedState, error) {
+		if state == nil || state.UUID != k.UUID {
+			k.Logger.Info("Delete(): cluster is not recorded in shared state file", "kind-cluster-name", k.ClusterName(), "state-file", k.StateFile)
+			return state, k.delete()
+		}
+		state.dropLease(k.leaseID)
+		if len(state.Leases) > 0 {
+			k.Logger.Info("Delete(): retaining shared cluster for other holders", "kind-cluster-name", k.ClusterName(), "leases", len(state.Leases))
+			return state, nil
+		}
+		if isRetained(k.ClusterName()) {
+			k.Logger.Info("Delete(): no-op, shared cluster was retained by another holder", "kind-cluster-name", k.ClusterName())
+			return nil, nil
+		}
+		return nil, k.delete()
+	})
+}
@@ -0,0 +1,165 @@
+package kind
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+	"sigs.k8s.io/kind/pkg/cluster/nodeutils"
+)
+
+// Snapshot of etcd state of the control-plane
+type Snapshot struct {
+	Name string
+	// Path is where the snapshot is stored on the host
+	Path    string
+	Created time.Time
+}
+
+const (
+	snapshotNodePath = "/var/lib/etcd/kte-snapshot.db"
+	restoreNodePath  = "/var/lib/kte-snapshot.db"
+
+	// etcdutlScript copies etcdutl (or etcdctl, which can also restore snapshots) out of the
+	// etcd container, as it's not installed on the node and the container will be stopped
+	// during restore
+	etcdutlScript = `
+set -o errexit -o nounset
+etcd="$(crictl ps --quiet --name '^etcd$')"
+if [ -z "${etcd}" ]; then echo "etcd is not running" >&2; exit 1; fi
+rootfs="$(echo /run/containerd/io.containerd.runtime.v2.task/k8s.io/${etcd}*/rootfs)"
+for bin in etcdutl etcdctl; do
+  if [ -x "${rootfs}/usr/local/bin/${bin}" ]; then
+    cp "${rootfs}/usr/local/bin/${bin}" /usr/local/bin/kte-etcdutl
+    break
+  fi
+done
+crictl exec "${etcd}" etcdctl \
+  --endpoints=https://127.0.0.1:2379 \
+  --cacert=/etc/kubernetes/pki/etcd/ca.crt \
+  --cert=/etc/kubernetes/pki/etcd/healthcheck-client.crt \
+  --key=/etc/kubernetes/pki/etcd/healthcheck-client.key \
+  snapshot save ` + snapshotNodePath + `
+`
+
+	// restoreScript stops etcd and API server by moving their static pod manifests
+	// out of the way, and moves them back once the data directory has been replaced
+	restoreScript = `
+set -o errexit -o nounset
+manifests=/etc/kubernetes/manifests
+stash=/etc/kubernetes/kte-manifests
+mkdir -p "${stash}"
+mv "${manifests}/etcd.yaml" "${manifests}/kube-apiserver.yaml" "${stash}/"
+trap 'mv "${stash}"/*.yaml "${manifests}/"' EXIT
+while [ -n "$(crictl ps --quiet --name '^(etcd|kube-apiserver)$')" ]; do sleep 1; done
+name="$(sed -n 's/^ *- --name=//p' "${stash}/etcd.yaml")"
+peer="$(sed -n 's/^ *- --initial-advertise-peer-urls=//p' "${stash}/etcd.yaml")"
+rm -rf /var/lib/etcd-kte-restore
+/usr/local/bin/kte-etcdutl snapshot restore ` + restoreNodePath + ` \
+  --name "${name}" \
+  --initial-cluster "${name}=${peer}" \
+  --initial-advertise-peer-urls "${peer}" \
+  --data-dir /var/lib/etcd-kte-restore
+rm -rf /var/lib/etcd/member
+mv /var/lib/etcd-kte-restore/member /var/lib/etcd/member
+rm -rf /var/lib/etcd-kte-restore ` + restoreNodePath + `
+`
+)
+
+func (k *Managed) snapshotsDir() string {
+	return filepath.Join(k.ArtifactDir, k.ClusterName(), "snapshots")
+}
+
+// etcdNode returns the control-plane node, clusters with multiple control-plane nodes
+// are not supported, as all members of etcd cluster would need to be restored
+func (k *Managed) etcdNode() (nodes.Node, error) {
+	all, err := k.Provider.ListInternalNodes(k.ClusterName())
+	if err != nil {
+		return nil, err
+	}
+	controlPlanes, err := nodeutils.ControlPlaneNodes(all)
+	if err != nil {
+		return nil, err
+	}
+	if len(controlPlanes) != 1 {
+		return nil, fmt.Errorf("snapshots require a single control-plane node, cluster %q has %d", k.ClusterName(), len(controlPlanes))
+	}
+	return controlPlanes[0], nil
+}
+
+// Snapshot saves etcd state, so that the cluster can be returned to it by Restore
+func (k *Managed) Snapshot(ctx context.Context) (*Snapshot, error) {
+	node, err := k.etcdNode()
+	if err != nil {
+		return nil, err
+	}
+	created := time.Now()
+	snapshot := &Snapshot{
+		Name:    "snapshot-" + created.UTC().Format("20060102T150405.000000000"),
+		Created: created,
+	}
+	snapshot.Path = filepath.Join(k.snapshotsDir(), snapshot.Name+".db")
+
+	k.Logger.Info("Snapshot(): saving etcd snapshot", "kind-cluster-name", k.ClusterName(), "snapshot", snapshot.Path)
+	if err := os.MkdirAll(k.snapshotsDir(), 0o755); err != nil {
+		return nil, err
+	}
+	if err := node.CommandContext(ctx, "sh", "-c", etcdutlScript).Run(); err != nil {
+		return nil, fmt.Errorf("failed to save etcd snapshot: %w", err)
+	}
+
+	f, err := os.Create(snapshot.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := node.CommandContext(ctx, "cat", snapshotNodePath).SetStdout(f).Run(); err != nil {
+		return nil, fmt.Errorf("failed to copy etcd snapshot from node %q: %w", node.String(), err)
+	}
+	if err := node.CommandContext(ctx, "rm", "-f", snapshotNodePath).Run(); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// Restore replaces etcd state with the snapshot, etcd and API server are restarted,
+// it returns once the API server is ready
+func (k *Managed) Restore(ctx context.Context, snapshot *Snapshot) error {
+	node, err := k.etcdNode()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(snapshot.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	k.Logger.Info("Restore(): restoring etcd snapshot", "kind-cluster-name", k.ClusterName(), "snapshot", snapshot.Path)
+	if err := node.CommandContext(ctx, "cp", "/dev/stdin", restoreNodePath).SetStdin(f).Run(); err != nil {
+		return fmt.Errorf("failed to copy etcd snapshot to node %q: %w", node.String(), err)
+	}
+	if err := node.CommandContext(ctx, "sh", "-c", restoreScript).Run(); err != nil {
+		return fmt.Errorf("failed to restore etcd snapshot: %w", err)
+	}
+	return k.waitForAPIServer(ctx)
+}
+
+func (k *Managed) waitForAPIServer(ctx context.Context) error {
+	clientMaker, err := k.NewClientMaker()
+	if err != nil {
+		return err
+	}
+	clientSet, err := clientMaker.NewClientSet()
+	if err != nil {
+		return err
+	}
+	return wait.PollUntilContextCancel(ctx, time.Second, true, func(ctx context.Context) (bool, error) {
+		return clientSet.Discovery().RESTClient().Get().AbsPath("/readyz").Do(ctx).Error() == nil, nil
+	})
+}
@@ -0,0 +1,107 @@
+package kind
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgo "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// TestTargetName is the name of the ConfigMap in kube-system that marks a cluster
+	// as a test target, it must have TestTargetLabel set to 'true'
+	TestTargetName  = "kube-test-env"
+	TestTargetLabel = "kube-test-env.errordeveloper.github.io/test-target"
+
+	// EnvAllowUnmarkedTarget allows pre-existing clusters that are not marked as test
+	// targets to be used, it must be set to 'true'
+	EnvAllowUnmarkedTarget = "KTE_ALLOW_UNMARKED_TARGET"
+)
+
+// MarkTestTarget marks the cluster, so that it can be used as a pre-existing cluster,
+// managed clusters are marked on Create
+func MarkTestTarget(ctx context.Context, k KindProvider) error {
+	var clientConfig *rest.Config
+	var err error
+	if unmanaged, ok := k.(*Unmanaged); ok {
+		clientConfig, err = unmanaged.unverifiedClientConfig()
+	} else {
+		clientConfig, err = k.NewClientConfig()
+	}
+	if err != nil {
+		return err
+	}
+	clientSet, err := clientgo.NewForConfig(clientConfig)
+	if err != nil {
+		return err
+	}
+	marker := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      TestTargetName,
+			Namespace: metav1.NamespaceSystem,
+			Labels:    map[string]string{TestTargetLabel: "true"},
+		},
+		Data: map[string]string{
+			"markedAt": time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+	_, err = clientSet.CoreV1().ConfigMaps(metav1.NamespaceSystem).Create(ctx, marker, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		patch := fmt.Sprintf(`{"metadata":{"labels":{%q:"true"}}}`, TestTargetLabel)
+		_, err = clientSet.CoreV1().ConfigMaps(metav1.NamespaceSystem).Patch(ctx, TestTargetName, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to mark cluster %q as test target: %w", k.ClusterName(), err)
+	}
+	return nil
+}
+
+// verifyTestTarget checks that the cluster is marked by MarkTestTarget, unless
+// EnvAllowUnmarkedTarget is set; it only succeeds once the check passes
+func (k *Unmanaged) verifyTestTarget(ctx context.Context) error {
+	k.verifiedLock.Lock()
+	defer k.verifiedLock.Unlock()
+
+	if k.verified {
+		return nil
+	}
+	if os.Getenv(EnvAllowUnmarkedTarget) == "true" {
+		k.Logger.Info("not verifying that the cluster is a test target as '" + EnvAllowUnmarkedTarget + "=true' was set")
+		k.verified = true
+		return nil
+	}
+	clientConfig, err := k.unverifiedClientConfig()
+	if err != nil {
+		return err
+	}
+	clientSet, err := clientgo.NewForConfig(clientConfig)
+	if err != nil {
+		return err
+	}
+	marker, err := clientSet.CoreV1().ConfigMaps(metav1.NamespaceSystem).Get(ctx, TestTargetName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		return fmt.Errorf("cannot verify that cluster at %q is a test target: %w", clientConfig.Host, err)
+	case marker.Labels[TestTargetLabel] == "true":
+		k.verified = true
+		return nil
+	}
+	return fmt.Errorf("refusing to use cluster at %q as it's not marked as a test target,"+
+		" mark it with kind.MarkTestTarget or set '%s=true' to override"+
+		" (ConfigMap %s/%s with label '%s=true')",
+		clientConfig.Host, EnvAllowUnmarkedTarget, metav1.NamespaceSystem, TestTargetName, TestTargetLabel)
+}
+
+// CanReset always returns an error, a pre-existing cluster may hold objects that
+// were not created by tests, even if it's marked as a test target
+func (k *Unmanaged) CanReset(_ context.Context) error {
+	return fmt.Errorf("cluster %q was not created by kube-test-env", k.ClusterName())
+}
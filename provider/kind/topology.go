@@ -0,0 +1,354 @@
+package kind
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+	"sigs.k8s.io/kind/pkg/cluster/nodeutils"
+)
+
+const (
+	kindClusterLabel = "io.x-k8s.kind.cluster"
+	kindRoleLabel    = "io.x-k8s.kind.role"
+
+	joinConfigPath     = "/kind/kte-join.conf"
+	containerdConfPath = "/etc/containerd/config.toml"
+
+	envContainerdSnapshotter = "KIND_EXPERIMENTAL_CONTAINERD_SNAPSHOTTER"
+)
+
+// AddNodes creates count new nodes and joins them to the running cluster, it returns
+// their names once they are ready; only worker nodes can be added, and of all the
+// kubeadm config patches only taints set with WithNodeTaint are applied; when a node
+// fails to join, it's removed and the names of nodes added before it are returned
+// along with the error
+func (k *Managed) AddNodes(ctx context.Context, role NodeRole, count int, opts ...NodeOption) ([]string, error) {
+	if role != WorkerRole {
+		return nil, fmt.Errorf("cannot add nodes with role %q, only %q nodes can be added", role, WorkerRole)
+	}
+	node := &Node{Role: role, Image: k.NodeImage}
+	for _, opt := range opts {
+		opt(node)
+	}
+
+	controlPlane, err := k.bootstrapControlPlane()
+	if err != nil {
+		return nil, err
+	}
+	if node.Image == "" {
+		out, err := exec.CommandContext(ctx, "docker", "inspect", "--format", "{{.Config.Image}}", controlPlane.String()).Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect node %q: %w", controlPlane.String(), err)
+		}
+		node.Image = strings.TrimSpace(string(out))
+	}
+
+	names, err := k.newNodeNames(role, count)
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range names {
+		k.Logger.Info("AddNodes(): adding node", "kind-cluster-name", k.ClusterName(), "node", name, "image", node.Image)
+		if err := k.addNode(ctx, controlPlane, name, node); err != nil {
+			err = fmt.Errorf("failed to add node %q: %w", name, err)
+			return names[:i], errors.Join(err, k.removeFailedNode(controlPlane, name))
+		}
+	}
+	return names, nil
+}
+
+// removeFailedNode deletes what addNode may have created, it doesn't use the context
+// of AddNodes, as that may be the reason for the failure
+func (k *Managed) removeFailedNode(controlPlane nodes.Node, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	k.Logger.Info("AddNodes(): removing node that failed to join", "kind-cluster-name", k.ClusterName(), "node", name)
+	errs := []error{}
+	if err := controlPlane.CommandContext(ctx, "kubectl", "--kubeconfig=/etc/kubernetes/admin.conf",
+		"delete", "node", name, "--ignore-not-found").Run(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to delete node %q: %w", name, err))
+	}
+	if out, err := exec.CommandContext(ctx, "docker", "rm", "--force", "--volumes", name).CombinedOutput(); err != nil &&
+		!strings.Contains(string(out), "No such container") {
+		errs = append(errs, fmt.Errorf("failed to remove container of node %q: %w: %s", name, err, out))
+	}
+	return errors.Join(errs...)
+}
+
+// RemoveNode drains the node, deletes it from the cluster and removes its container
+func (k *Managed) RemoveNode(ctx context.Context, name string) error {
+	node, err := k.node(name)
+	if err != nil {
+		return err
+	}
+	role, err := node.Role()
+	if err != nil {
+		return err
+	}
+	if role != string(WorkerRole) {
+		return fmt.Errorf("cannot remove node %q with role %q, only %q nodes can be removed", name, role, WorkerRole)
+	}
+	controlPlane, err := k.bootstrapControlPlane()
+	if err != nil {
+		return err
+	}
+
+	k.Logger.Info("RemoveNode(): draining node", "kind-cluster-name", k.ClusterName(), "node", name)
+	kubeconfig := "--kubeconfig=/etc/kubernetes/admin.conf"
+	if err := controlPlane.CommandContext(ctx, "kubectl", kubeconfig, "drain", name,
+		"--ignore-daemonsets", "--delete-emptydir-data", "--force").Run(); err != nil {
+		return fmt.Errorf("failed to drain node %q: %w", name, err)
+	}
+	k.Logger.Info("RemoveNode(): deleting node", "kind-cluster-name", k.ClusterName(), "node", name)
+	if err := controlPlane.CommandContext(ctx, "kubectl", kubeconfig, "delete", "node", name, "--ignore-not-found").Run(); err != nil {
+		return fmt.Errorf("failed to delete node %q: %w", name, err)
+	}
+	if out, err := exec.CommandContext(ctx, "docker", "rm", "--force", "--volumes", name).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to remove container of node %q: %w: %s", name, err, out)
+	}
+	return nil
+}
+
+// bootstrapControlPlane returns the control-plane node that kind joins other nodes
+// through, it has kubeadm and kubectl configured with admin credentials
+func (k *Managed) bootstrapControlPlane() (nodes.Node, error) {
+	all, err := k.Provider.ListInternalNodes(k.ClusterName())
+	if err != nil {
+		return nil, err
+	}
+	return nodeutils.BootstrapControlPlaneNode(all)
+}
+
+// newNodeNames follows kind naming, i.e. '<cluster>-worker', '<cluster>-worker2' etc,
+// and skips names of existing nodes
+func (k *Managed) newNodeNames(role NodeRole, count int) ([]string, error) {
+	all, err := k.Provider.ListNodes(k.ClusterName())
+	if err != nil {
+		return nil, err
+	}
+	existing := map[string]bool{}
+	for _, node := range all {
+		existing[node.String()] = true
+	}
+	names := []string{}
+	for i := 1; len(names) < count; i++ {
+		name := k.ClusterName() + "-" + string(role)
+		if i > 1 {
+			name += strconv.Itoa(i)
+		}
+		if !existing[name] {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (k *Managed) addNode(ctx context.Context, controlPlane nodes.Node, name string, node *Node) error {
+	args := []string{
+		"run", "--name", name, "--hostname", name,
+		"--detach", "--tty",
+		"--label", kindClusterLabel + "=" + k.ClusterName(),
+		"--label", kindRoleLabel + "=" + string(node.Role),
+		"--net", DockerNetwork(),
+		"--restart=on-failure:1", "--init=false", "--cgroupns=private",
+		"--privileged",
+		"--security-opt", "seccomp=unconfined",
+		"--security-opt", "apparmor=unconfined",
+		"--tmpfs", "/tmp", "--tmpfs", "/run",
+		"--volume", "/var",
+		"--volume", "/lib/modules:/lib/modules:ro",
+		// systemd and the entrypoint of the node image rely on it
+		"--env", "container=docker",
+		// same as kind, it's passed through to the entrypoint only if it's set
+		"--env", envContainerdSnapshotter,
+	}
+	for _, mount := range node.ExtraMounts {
+		bind := mount.HostPath + ":" + mount.ContainerPath
+		if mount.Readonly {
+			bind += ":ro"
+		}
+		args = append(args, "--volume", bind)
+	}
+	for _, mapping := range node.ExtraPortMappings {
+		args = append(args, "--publish", portMapping(mapping))
+	}
+	args = append(args, node.Image)
+	if out, err := exec.CommandContext(ctx, "docker", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create container: %w: %s", err, out)
+	}
+
+	newNode, err := k.node(name)
+	if err != nil {
+		return err
+	}
+	if err := waitForSystemd(ctx, newNode); err != nil {
+		return err
+	}
+
+	// containerd config patches are applied at create time, so they are copied from
+	// the control-plane node
+	containerdConfig := &bytes.Buffer{}
+	if err := controlPlane.CommandContext(ctx, "cat", containerdConfPath).SetStdout(containerdConfig).Run(); err != nil {
+		return fmt.Errorf("failed to read containerd config: %w", err)
+	}
+	if err := nodeutils.WriteFile(newNode, containerdConfPath, containerdConfig.String()); err != nil {
+		return err
+	}
+	if k.LocalRegistry != nil {
+		if err := k.configureLocalRegistry(newNode); err != nil {
+			return err
+		}
+	}
+	if err := newNode.CommandContext(ctx, "systemctl", "restart", "containerd").Run(); err != nil {
+		return fmt.Errorf("failed to restart containerd: %w", err)
+	}
+
+	joinConfig, err := k.joinConfiguration(ctx, controlPlane, newNode, node)
+	if err != nil {
+		return err
+	}
+	if err := nodeutils.WriteFile(newNode, joinConfigPath, joinConfig); err != nil {
+		return err
+	}
+	if err := newNode.CommandContext(ctx, "kubeadm", "join", "--config", joinConfigPath, "--skip-phases=preflight").Run(); err != nil {
+		return fmt.Errorf("kubeadm join failed: %w", err)
+	}
+
+	if err := k.waitForNodeReady(ctx, name, true); err != nil {
+		return err
+	}
+	return k.labelNode(ctx, name, node.Labels)
+}
+
+// portMapping follows kind, except that docker picks a random port when HostPort is 0
+func portMapping(mapping PortMapping) string {
+	listenAddress := mapping.ListenAddress
+	if listenAddress == "" {
+		listenAddress = "0.0.0.0"
+	}
+	hostPort := ""
+	if mapping.HostPort != 0 {
+		hostPort = strconv.Itoa(int(mapping.HostPort))
+	}
+	protocol := strings.ToLower(string(mapping.Protocol))
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	return fmt.Sprintf("%s:%d/%s", net.JoinHostPort(listenAddress, hostPort), mapping.ContainerPort, protocol)
+}
+
+func waitForSystemd(ctx context.Context, node nodes.Node) error {
+	return wait.PollUntilContextTimeout(ctx, time.Second, time.Minute, true, func(ctx context.Context) (bool, error) {
+		out := &bytes.Buffer{}
+		// it exits with non-zero code while starting or when degraded
+		_ = node.CommandContext(ctx, "systemctl", "is-system-running").SetStdout(out).Run()
+		state := strings.TrimSpace(out.String())
+		return state == "running" || state == "degraded", nil
+	})
+}
+
+// joinConfiguration mirrors what kind uses for joining worker nodes, with a new
+// bootstrap token
+func (k *Managed) joinConfiguration(ctx context.Context, controlPlane, newNode nodes.Node, node *Node) (string, error) {
+	out := &bytes.Buffer{}
+	if err := controlPlane.CommandContext(ctx, "kubeadm", "token", "create", "--print-join-command").SetStdout(out).Run(); err != nil {
+		return "", fmt.Errorf("failed to create bootstrap token: %w", err)
+	}
+	// 'kubeadm join <endpoint> --token <token> --discovery-token-ca-cert-hash <hash>'
+	fields := strings.Fields(out.String())
+	if len(fields) < 7 || fields[3] != "--token" || fields[5] != "--discovery-token-ca-cert-hash" {
+		return "", fmt.Errorf("unexpected join command: %q", out.String())
+	}
+	ipv4, ipv6, err := newNode.IP()
+	if err != nil {
+		return "", err
+	}
+	nodeIP := ipv4
+	if nodeIP == "" {
+		nodeIP = ipv6
+	}
+	kubeVersion, err := nodeutils.KubeVersion(newNode)
+	if err != nil {
+		return "", fmt.Errorf("failed to get Kubernetes version of node %q: %w", newNode.String(), err)
+	}
+	apiVersion, err := kubeadmAPIVersion(kubeVersion)
+	if err != nil {
+		return "", err
+	}
+
+	config := map[string]any{
+		"apiVersion": apiVersion,
+		"kind":       "JoinConfiguration",
+		"discovery": map[string]any{
+			"bootstrapToken": map[string]any{
+				"apiServerEndpoint": fields[2],
+				"token":             fields[4],
+				"caCertHashes":      []string{fields[6]},
+			},
+		},
+		"nodeRegistration": map[string]any{
+			"criSocket": "unix:///run/containerd/containerd.sock",
+			"kubeletExtraArgs": map[string]string{
+				"node-ip":     nodeIP,
+				"provider-id": "kind://docker/" + k.ClusterName() + "/" + newNode.String(),
+			},
+			"taints": nodeTaints(node),
+		},
+	}
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// kubeadmAPIVersion picks the same kubeadm config API version as kind does, v1beta3
+// is only available from 1.22, but kind uses it from 1.23
+func kubeadmAPIVersion(kubeVersion string) (string, error) {
+	v, err := version.ParseSemantic(kubeVersion)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse Kubernetes version %q: %w", kubeVersion, err)
+	}
+	if v.LessThan(version.MustParseSemantic("v1.23.0")) {
+		return "kubeadm.k8s.io/v1beta2", nil
+	}
+	return "kubeadm.k8s.io/v1beta3", nil
+}
+
+// labelNode sets labels via the API, as kubelet is not allowed to set some of them,
+// e.g. 'node-role.kubernetes.io/*'
+func (k *Managed) labelNode(ctx context.Context, name string, labels map[string]string) error {
+	if len(labels) == 0 {
+		return nil
+	}
+	clientMaker, err := k.NewClientMaker()
+	if err != nil {
+		return err
+	}
+	clientSet, err := clientMaker.NewClientSet()
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"labels": labels}})
+	if err != nil {
+		return err
+	}
+	_, err = clientSet.CoreV1().Nodes().Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
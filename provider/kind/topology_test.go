@@ -0,0 +1,38 @@
+package kind
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	configv1alpha4 "sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
+)
+
+func TestKindJoinConfigurationAPIVersion(t *testing.T) {
+	g := NewWithT(t)
+
+	for kubeVersion, apiVersion := range map[string]string{
+		"v1.21.14": "kubeadm.k8s.io/v1beta2",
+		"v1.22.17": "kubeadm.k8s.io/v1beta2",
+		"v1.23.17": "kubeadm.k8s.io/v1beta3",
+		"v1.27.3":  "kubeadm.k8s.io/v1beta3",
+	} {
+		g.Expect(kubeadmAPIVersion(kubeVersion)).To(Equal(apiVersion), kubeVersion)
+	}
+	_, err := kubeadmAPIVersion("latest")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestKindPortMapping(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(portMapping(PortMapping{ContainerPort: 80, HostPort: 8080})).To(Equal("0.0.0.0:8080:80/tcp"))
+	g.Expect(portMapping(PortMapping{ContainerPort: 80})).To(Equal("0.0.0.0::80/tcp"))
+	g.Expect(portMapping(PortMapping{
+		ContainerPort: 53,
+		HostPort:      5353,
+		ListenAddress: "127.0.0.1",
+		Protocol:      configv1alpha4.PortMappingProtocolUDP,
+	})).To(Equal("127.0.0.1:5353:53/udp"))
+	g.Expect(portMapping(PortMapping{ContainerPort: 80, HostPort: 8080, ListenAddress: "::1"})).To(Equal("[::1]:8080:80/tcp"))
+}
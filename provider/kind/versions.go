@@ -0,0 +1,115 @@
+package kind
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// EnvNodeImages overrides entries of NodeImages, e.g. '1.27=kindest/node:v1.27.3,1.28=example.com/node:v1.28.0'
+	EnvNodeImages = "KTE_NODE_IMAGES"
+	// EnvNodeImagesFile points to a YAML or JSON file with a map of versions to images,
+	// which overrides NodeImages, but not EnvNodeImages
+	EnvNodeImagesFile = "KTE_NODE_IMAGES_FILE"
+)
+
+// NodeImages maps Kubernetes minor versions to node images that were built for
+// the version of kind this package uses, see https://github.com/kubernetes-sigs/kind/releases/tag/v0.20.0
+var NodeImages = map[string]string{
+	"1.27": "kindest/node:v1.27.3@sha256:3966ac761ae0136263ffdb6cfd4db23ef8a83cba8a463690e98317add2c9ba72",
+	"1.26": "kindest/node:v1.26.6@sha256:6e2d8b28a5b601defe327b98bd1c2d1930b49e5d8c512e1895099e4504007adb",
+	"1.25": "kindest/node:v1.25.11@sha256:227fa11ce74ea76a0474eeefb84cb75d8dad1b08638371ecf0e86259b35be0c8",
+	"1.24": "kindest/node:v1.24.15@sha256:7db4f8bea3e14b82d12e044e25e34bd53754b7f2b0e9d56df21774e6f66a70ab",
+	"1.23": "kindest/node:v1.23.17@sha256:59c989ff8a517a93127d4a536e7014d28e235fb3529d9fba91b3951d461edfdb",
+	"1.22": "kindest/node:v1.22.17@sha256:f5b2e5698c6c9d6d0adc419c0deae21a425c07d81bbf3b6a6834042f25d4fba2",
+	"1.21": "kindest/node:v1.21.14@sha256:8a4e9bb3f415d2bb81629ce33ef9c76ba514c14d707f9797a01e3216376ba093",
+}
+
+// NodeImageCatalog returns NodeImages with overrides from EnvNodeImagesFile and EnvNodeImages applied
+func NodeImageCatalog() (map[string]string, error) {
+	catalog := map[string]string{}
+	for version, image := range NodeImages {
+		catalog[version] = image
+	}
+
+	if path := os.Getenv(EnvNodeImagesFile); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		overrides := map[string]string{}
+		if err := yaml.UnmarshalStrict(data, &overrides); err != nil {
+			return nil, fmt.Errorf("cannot parse %q: %w", path, err)
+		}
+		for version, image := range overrides {
+			catalog[minorVersion(version)] = image
+		}
+	}
+
+	if value := os.Getenv(EnvNodeImages); value != "" {
+		for _, entry := range strings.Split(value, ",") {
+			version, image, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if !ok || version == "" || image == "" {
+				return nil, fmt.Errorf("invalid entry %q in %s, expected '<version>=<image>'", entry, EnvNodeImages)
+			}
+			catalog[minorVersion(version)] = image
+		}
+	}
+	return catalog, nil
+}
+
+// NodeImageFor returns the node image for a Kubernetes version, e.g. '1.27', 'v1.27' or '1.27.3',
+// only the minor version is used for lookup
+func NodeImageFor(version string) (string, error) {
+	catalog, err := NodeImageCatalog()
+	if err != nil {
+		return "", err
+	}
+	image, ok := catalog[minorVersion(version)]
+	if !ok {
+		return "", fmt.Errorf("no node image for Kubernetes version %q", version)
+	}
+	return image, nil
+}
+
+// SupportedVersions returns minor versions from NodeImageCatalog, newest first
+func SupportedVersions() ([]string, error) {
+	catalog, err := NodeImageCatalog()
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]string, 0, len(catalog))
+	for version := range catalog {
+		versions = append(versions, version)
+	}
+	slices.SortFunc(versions, func(a, b string) int { return compareMinorVersions(b, a) })
+	return versions, nil
+}
+
+func minorVersion(version string) string {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 {
+		return strings.Join(parts, ".")
+	}
+	return parts[0] + "." + parts[1]
+}
+
+func compareMinorVersions(a, b string) int {
+	parse := func(version string) (int, int) {
+		major, minor, _ := strings.Cut(version, ".")
+		x, _ := strconv.Atoi(major)
+		y, _ := strconv.Atoi(minor)
+		return x, y
+	}
+	aMajor, aMinor := parse(a)
+	bMajor, bMinor := parse(b)
+	if aMajor != bMajor {
+		return aMajor - bMajor
+	}
+	return aMinor - bMinor
+}
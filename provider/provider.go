@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	klog "k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/errordeveloper/kube-test-env/addons"
+	"github.com/errordeveloper/kube-test-env/clients"
+)
+
+type Provider interface {
+	ClusterName() string
+	KubeConfigPath() string
+	NewClientConfig() (*rest.Config, error)
+	NewClientMaker() (*clients.ClientMaker, error)
+	ApplyAddons(context.Context, addons.Config) error
+}
+
+type Lifecycle interface {
+	Provider
+
+	Create() error
+	CollectLogs() error
+	LogsDir() string
+	Delete() error
+
+	CreateContext(context.Context) error
+	CollectLogsContext(context.Context) error
+	DeleteContext(context.Context) error
+}
+
+type Options struct {
+	ArtifactDir string
+	Logger      klog.Logger
+
+	// Config is backend-specific, e.g. *kind.Cluster for the kind backend
+	Config  any
+	Timeout time.Duration
+
+	// Shared is set by Shared, backends may use it to share the cluster beyond
+	// the current process
+	Shared bool
+}
+
+type Common[T Provider] struct {
+	k      T
+	logger klog.Logger
+}
+
+var Log = klog.NewKlogr()
+
+func init() {
+	ctrl.SetLogger(Log.WithName("kte-controller-runtime"))
+}
+
+func NewCommon[T Provider](k T, logger klog.Logger) Common[T] {
+	return Common[T]{
+		k:      k,
+		logger: logger,
+	}
+}
+
+// KubeContextProvider is implemented by providers that know which context of
+// the kubeconfig refers to their cluster, it's used instead of the current context
+type KubeContextProvider interface {
+	KubeContext() string
+}
+
+// ResetChecker is implemented by providers whose cluster may be used by other processes
+// or may not have been created for tests, SharedReset refuses to delete anything unless
+// CanReset returns nil
+type ResetChecker interface {
+	CanReset(context.Context) error
+}
+
+func (k Common[T]) NewClientConfig() (*rest.Config, error) {
+	overrides := &clientcmd.ConfigOverrides{}
+	if p, ok := any(k.k).(KubeContextProvider); ok {
+		overrides.CurrentContext = p.KubeContext()
+	}
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{
+			ExplicitPath: k.k.KubeConfigPath(),
+		},
+		overrides)
+
+	return loader.ClientConfig()
+}
+
+func (k Common[T]) NewClientMaker() (*clients.ClientMaker, error) {
+	clientConfig, err := k.k.NewClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	return clients.NewClientMaker(clientConfig, Log), nil
+}
+
+func (k Common[T]) ApplyAddons(ctx context.Context, config addons.Config) error {
+	m, err := k.k.NewClientMaker()
+	if err != nil {
+		return err
+	}
+	rm, err := m.NewResourceManager()
+	if err != nil {
+		return err
+	}
+	return addons.Apply(ctx, rm, config)
+}
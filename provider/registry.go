@@ -0,0 +1,262 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/errordeveloper/kube-test-env/clients"
+)
+
+const (
+	// EnvProvider selects a registered backend to be used in place of the one
+	// requested in code, e.g. 'KTE_PROVIDER=envtest' runs kind tests against envtest
+	EnvProvider = "KTE_PROVIDER"
+
+	EnvForceIsolated    = "KTE_FORCE_ISOLATED"
+	EnvForceIsolatedAll = "all"
+)
+
+type Factory func(Options) (Lifecycle, error)
+
+type sharedProvider struct {
+	once     *sync.Once
+	k        Lifecycle
+	err      error
+	baseline *clients.Baseline
+}
+
+var registry = struct {
+	sync.Mutex
+	factories map[string]Factory
+	shared    map[string]*sharedProvider
+}{
+	factories: map[string]Factory{},
+	shared:    map[string]*sharedProvider{},
+}
+
+// Register makes a backend available by name, it's meant to be called
+// from the init function of the package that implements the backend
+func Register(name string, factory Factory) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if factory == nil {
+		panic("provider: Register factory is nil")
+	}
+	if _, dup := registry.factories[name]; dup {
+		panic("provider: Register called twice for " + name)
+	}
+	registry.factories[name] = factory
+}
+
+func Names() []string {
+	registry.Lock()
+	defer registry.Unlock()
+
+	names := make([]string, 0, len(registry.factories))
+	for name := range registry.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates a provider of the named backend, or of the backend set by EnvProvider;
+// backends are only available if their packages are imported
+func New(name string, opts Options) (Lifecycle, error) {
+	if override, ok := os.LookupEnv(EnvProvider); ok && override != "" && override != name {
+		opts.Logger.Info("using provider '"+override+"' as '"+EnvProvider+"="+override+"' was set", "requested-provider", name)
+		name = override
+	}
+
+	registry.Lock()
+	factory, ok := registry.factories[name]
+	registry.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown provider '%s' (forgotten import?), registered providers: %v", name, Names())
+	}
+	return factory(opts)
+}
+
+func Shared(name string, opts Options) (Provider, error) {
+	return SharedContext(context.Background(), name, opts)
+}
+
+// SharedContext is like Shared, but creation of the cluster is aborted when ctx
+// is done, in which case CancelledError is returned from all subsequent calls
+func SharedContext(ctx context.Context, name string, opts Options) (Provider, error) {
+	registry.Lock()
+	s, ok := registry.shared[name]
+	if !ok {
+		s = &sharedProvider{once: &sync.Once{}}
+		registry.shared[name] = s
+	}
+	registry.Unlock()
+
+	logger := opts.Logger
+
+	s.once.Do(func() {
+		logger.Info("initializing shared provider", "provider", name)
+		if opts.ArtifactDir == "" {
+			artifactDir, err := os.MkdirTemp("", "kte-"+name+"-shared-provider-")
+			if err != nil {
+				s.err = err
+				return
+			}
+			opts.ArtifactDir = artifactDir
+		}
+		sharedOpts := opts
+		sharedOpts.Logger = logger.WithName(name + "-shared-provider")
+		sharedOpts.Shared = true
+		k, err := New(name, sharedOpts)
+		if err != nil {
+			s.err = err
+			return
+		}
+		registry.Lock()
+		s.k = k
+		registry.Unlock()
+
+		logger.Info("creating cluster with shared provider", "provider", name)
+		s.err = k.CreateContext(ctx)
+	})
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	if v, ok := os.LookupEnv(EnvForceIsolated); ok && v != EnvForceIsolatedAll {
+		logger.Info("using isolated provider as '" + EnvForceIsolated + "=" + EnvForceIsolatedAll + "' was set")
+		artifactDir, err := os.MkdirTemp("", "kte-"+name+"-shared-provider-")
+		if err != nil {
+			return nil, err
+		}
+		isolatedOpts := opts
+		isolatedOpts.ArtifactDir = artifactDir
+		k, err := New(name, isolatedOpts)
+		if err != nil {
+			return nil, err
+		}
+		if err := k.CreateContext(ctx); err != nil {
+			return nil, err
+		}
+		return k, nil
+	}
+
+	k := sharedLifecycle(name)
+	if k == nil {
+		return nil, fmt.Errorf("shared provider '%s' not initialized", name)
+	}
+
+	logger.Info("using shared provider", "provider", name, "cluster-name", k.ClusterName())
+
+	return k, nil
+}
+
+func sharedLifecycle(name string) Lifecycle {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if s, ok := registry.shared[name]; ok {
+		return s.k
+	}
+	return nil
+}
+
+func SharedCollectLogs(name string) error {
+	return SharedCollectLogsContext(context.Background(), name)
+}
+
+func SharedCollectLogsContext(ctx context.Context, name string) error {
+	k := sharedLifecycle(name)
+	if k == nil {
+		return nil
+	}
+	return k.CollectLogsContext(ctx)
+}
+
+func SharedLogsDir(name string) string {
+	k := sharedLifecycle(name)
+	if k == nil {
+		return ""
+	}
+	return k.LogsDir()
+}
+
+func SharedDelete(name string) error {
+	return SharedDeleteContext(context.Background(), name)
+}
+
+func SharedDeleteContext(ctx context.Context, name string) error {
+	k := sharedLifecycle(name)
+	if k == nil {
+		return nil
+	}
+	if err := k.DeleteContext(ctx); err != nil {
+		return err
+	}
+	registry.Lock()
+	registry.shared[name].k = nil
+	registry.Unlock()
+	return nil
+}
+
+func recordBaseline(ctx context.Context, k Provider) (*clients.Baseline, error) {
+	m, err := k.NewClientMaker()
+	if err != nil {
+		return nil, err
+	}
+	return m.RecordBaseline(ctx)
+}
+
+// SharedRecordBaseline records namespaces, CRDs, cluster-scoped RBAC and webhook
+// configurations of the shared cluster, which SharedReset keeps; it has to be called
+// explicitly, e.g. once addons have been installed
+func SharedRecordBaseline(ctx context.Context, name string) error {
+	k := sharedLifecycle(name)
+	if k == nil {
+		return fmt.Errorf("shared provider '%s' not initialized", name)
+	}
+	baseline, err := recordBaseline(ctx, k)
+	if err != nil {
+		return err
+	}
+	registry.Lock()
+	registry.shared[name].baseline = baseline
+	registry.Unlock()
+	return nil
+}
+
+// SharedReset deletes namespaces, CRDs, cluster-scoped RBAC and webhook configurations
+// that were added to the shared cluster since the baseline was recorded; it fails if
+// the provider implements ResetChecker and CanReset returns an error
+func SharedReset(ctx context.Context, name string) (*clients.ResetReport, error) {
+	var (
+		k        Lifecycle
+		baseline *clients.Baseline
+	)
+	registry.Lock()
+	if s, ok := registry.shared[name]; ok {
+		k, baseline = s.k, s.baseline
+	}
+	registry.Unlock()
+	if k == nil {
+		return nil, fmt.Errorf("shared provider '%s' not initialized", name)
+	}
+	if checker, ok := k.(ResetChecker); ok {
+		if err := checker.CanReset(ctx); err != nil {
+			return nil, fmt.Errorf("cannot reset shared provider '%s': %w", name, err)
+		}
+	}
+	if baseline == nil {
+		return nil, fmt.Errorf("no baseline recorded for shared provider '%s', SharedRecordBaseline needs to be called first", name)
+	}
+	m, err := k.NewClientMaker()
+	if err != nil {
+		return nil, err
+	}
+	return m.Reset(ctx, baseline)
+}
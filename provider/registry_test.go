@@ -0,0 +1,121 @@
+package provider_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	klog "k8s.io/klog/v2"
+
+	"github.com/errordeveloper/kube-test-env/provider"
+)
+
+type stubLifecycle struct {
+	provider.Common[provider.Provider]
+
+	created, deleted int
+}
+
+func (s *stubLifecycle) ClusterName() string    { return "kte-stub" }
+func (s *stubLifecycle) KubeConfigPath() string { return "" }
+func (s *stubLifecycle) LogsDir() string        { return "" }
+func (s *stubLifecycle) CollectLogs() error     { return nil }
+func (s *stubLifecycle) Create() error          { s.created++; return nil }
+func (s *stubLifecycle) Delete() error          { s.deleted++; return nil }
+
+func (s *stubLifecycle) CreateContext(context.Context) error      { return s.Create() }
+func (s *stubLifecycle) CollectLogsContext(context.Context) error { return s.CollectLogs() }
+func (s *stubLifecycle) DeleteContext(context.Context) error      { return s.Delete() }
+
+func TestRegistry(t *testing.T) {
+	g := NewWithT(t)
+
+	log := klog.Background()
+
+	stubs := []*stubLifecycle{}
+	provider.Register("stub", func(opts provider.Options) (provider.Lifecycle, error) {
+		s := &stubLifecycle{}
+		s.Common = provider.NewCommon[provider.Provider](s, opts.Logger)
+		stubs = append(stubs, s)
+		return s, nil
+	})
+
+	g.Expect(provider.Names()).To(ContainElement("stub"))
+	g.Expect(func() { provider.Register("stub", nil) }).To(Panic())
+
+	_, err := provider.New("unknown", provider.Options{Logger: log})
+	g.Expect(err).To(MatchError(ContainSubstring("unknown provider 'unknown'")))
+
+	k, err := provider.New("stub", provider.Options{Logger: log})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(k.Create()).To(Succeed())
+	g.Expect(stubs).To(HaveLen(1))
+
+	shared1, err := provider.Shared("stub", provider.Options{Logger: log, ArtifactDir: t.TempDir()})
+	g.Expect(err).NotTo(HaveOccurred())
+	shared2, err := provider.Shared("stub", provider.Options{Logger: log})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(shared1).To(BeIdenticalTo(shared2))
+	g.Expect(stubs).To(HaveLen(2))
+	g.Expect(stubs[1].created).To(Equal(1))
+
+	// baseline is only recorded by SharedRecordBaseline
+	_, err = provider.SharedReset(context.Background(), "stub")
+	g.Expect(err).To(MatchError(ContainSubstring("no baseline recorded")))
+
+	g.Expect(provider.SharedDelete("stub")).To(Succeed())
+	g.Expect(stubs[1].deleted).To(Equal(1))
+	g.Expect(provider.SharedDelete("stub")).To(Succeed())
+	g.Expect(stubs[1].deleted).To(Equal(1))
+}
+
+func TestRegistryEnvProvider(t *testing.T) {
+	g := NewWithT(t)
+
+	log := klog.Background()
+
+	created := 0
+	provider.Register("stub-override", func(opts provider.Options) (provider.Lifecycle, error) {
+		created++
+		s := &stubLifecycle{}
+		s.Common = provider.NewCommon[provider.Provider](s, opts.Logger)
+		return s, nil
+	})
+
+	t.Setenv(provider.EnvProvider, "stub-override")
+	_, err := provider.New("kind", provider.Options{Logger: log})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(created).To(Equal(1))
+
+	t.Setenv(provider.EnvProvider, "unknown")
+	_, err = provider.New("stub-override", provider.Options{Logger: log})
+	g.Expect(err).To(MatchError(ContainSubstring("unknown provider 'unknown'")))
+}
+
+type guardedStubLifecycle struct {
+	stubLifecycle
+}
+
+func (s *guardedStubLifecycle) CanReset(context.Context) error { return errors.New("in use") }
+
+func TestRegistrySharedResetChecker(t *testing.T) {
+	g := NewWithT(t)
+
+	log := klog.Background()
+
+	provider.Register("stub-guarded", func(opts provider.Options) (provider.Lifecycle, error) {
+		s := &guardedStubLifecycle{}
+		s.Common = provider.NewCommon[provider.Provider](s, opts.Logger)
+		return s, nil
+	})
+
+	_, err := provider.Shared("stub-guarded", provider.Options{Logger: log, ArtifactDir: t.TempDir()})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	_, err = provider.SharedReset(context.Background(), "stub-guarded")
+	g.Expect(err).To(MatchError(ContainSubstring("cannot reset shared provider 'stub-guarded': in use")))
+
+	g.Expect(provider.SharedDelete("stub-guarded")).To(Succeed())
+}